@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// benchResult holds the latencies of the successful
+// requests made by -bench and the number that failed
+type benchResult struct {
+	latencies []time.Duration
+	failed    int
+	elapsed   time.Duration
+}
+
+// runBench probes url n times using concurrency workers and
+// returns the latency of each successful request
+func runBench(client *http.Client, url string, opts *probeOptions, n, concurrency int) *benchResult {
+	jobs := make(chan struct{})
+	res := &benchResult{}
+	var mu sync.Mutex
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				r, err := isListening(client, url, opts)
+				mu.Lock()
+				if err != nil {
+					res.failed++
+				} else {
+					res.latencies = append(res.latencies, r.elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	res.elapsed = time.Since(start)
+
+	sort.Slice(res.latencies, func(i, j int) bool {
+		return res.latencies[i] < res.latencies[j]
+	})
+	return res
+}
+
+// percentile returns the pth percentile of the sorted latencies
+func (b *benchResult) percentile(p float64) time.Duration {
+	if len(b.latencies) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(b.latencies)-1))
+	return b.latencies[i]
+}
+
+// print writes a summary table of the benchmark to w
+func (b *benchResult) print(w io.Writer) {
+	total := len(b.latencies) + b.failed
+	fmt.Fprintf(w, "requests:   %d\n", total)
+	fmt.Fprintf(w, "failed:     %d\n", b.failed)
+	fmt.Fprintf(w, "duration:   %s\n", b.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput: %.1f req/s\n", float64(total)/b.elapsed.Seconds())
+	if len(b.latencies) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "min:        %s\n", b.latencies[0].Round(time.Microsecond))
+	fmt.Fprintf(w, "p50:        %s\n", b.percentile(50).Round(time.Microsecond))
+	fmt.Fprintf(w, "p90:        %s\n", b.percentile(90).Round(time.Microsecond))
+	fmt.Fprintf(w, "p99:        %s\n", b.percentile(99).Round(time.Microsecond))
+	fmt.Fprintf(w, "max:        %s\n", b.latencies[len(b.latencies)-1].Round(time.Microsecond))
+}
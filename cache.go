@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultCache remembers the outcome of probing each URL so that a
+// later run can reuse it instead of probing again. It's loaded from
+// and saved to a JSON file. A nil *resultCache is valid and caches
+// nothing. It is safe for concurrent use.
+type resultCache struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	read    bool
+	options string
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is the outcome of one probe: whether it was alive and,
+// if so, the result that passed the filters. Line and Result don't
+// include the parts that are added per run (the -diff marker, the
+// -include-input and -timestamp prefixes), and IP, Length and Title
+// are kept so that hits can be counted like fresh results. Hang is
+// set for a -slowloris-detect result that connected but timed out.
+type cacheEntry struct {
+	At      time.Time   `json:"at"`
+	Options string      `json:"options"`
+	Alive   bool        `json:"alive"`
+	Hang    bool        `json:"hang,omitempty"`
+	Line    string      `json:"line,omitempty"`
+	Result  *jsonResult `json:"result,omitempty"`
+	IP      string      `json:"ip,omitempty"`
+	Length  int64       `json:"length,omitempty"`
+	Title   string      `json:"title,omitempty"`
+}
+
+// uncachedFlags don't change whether a URL is output or how its line
+// looks, or are applied to cache hits too, so they're left out of the
+// options an entry is tied to
+var uncachedFlags = map[string]bool{
+	"cache": true, "cache-ttl": true, "no-cache": true,
+	"c": true, "buffer": true, "isolate-transports": true,
+	"o": true, "append-file": true, "append-urls": true, "rotate-size": true,
+	"webhook": true, "split-dir": true, "flush": true, "sort": true,
+	"count": true, "diff": true, "include-input": true, "timestamp": true,
+	"first-only": true, "unique-ip": true, "cluster-cl": true,
+	"body-size-histogram": true, "stats": true, "progress": true,
+	"metrics-addr": true, "resume": true, "v": true,
+}
+
+// cacheOptions describes the flags set on fs that affect results, so
+// that entries from a run with different filters or annotations
+// aren't reused
+func cacheOptions(fs *flag.FlagSet) string {
+	var opts []string
+	fs.Visit(func(f *flag.Flag) {
+		if !uncachedFlags[f.Name] {
+			opts = append(opts, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	sort.Strings(opts)
+	return strings.Join(opts, " ")
+}
+
+// openResultCache loads the cache file at path if it exists. When
+// read is false cached entries are ignored but new ones are saved.
+// Only entries saved with the same options are reused.
+func openResultCache(path string, ttl time.Duration, read bool, options string) (*resultCache, error) {
+	c := &resultCache{path: path, ttl: ttl, read: read, options: options, entries: make(map[string]cacheEntry)}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// get returns the entry for url if there's one younger than the TTL
+// that was saved with the same options
+func (c *resultCache) get(url string) (cacheEntry, bool) {
+	if c == nil || !c.read {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[url]
+	if !ok || e.Options != c.options || time.Since(e.At) > c.ttl {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// put records the outcome of probing url
+func (c *resultCache) put(url string, e cacheEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.At, e.Options = time.Now(), c.options
+	c.entries[url] = e
+}
+
+// save drops expired entries and writes the cache back to its file,
+// going via a temporary file so that a crash can't corrupt it
+func (c *resultCache) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for url, e := range c.entries {
+		if time.Since(e.At) > c.ttl {
+			delete(c.entries, url)
+		}
+	}
+
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".httprobe-cache-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
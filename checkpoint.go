@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// checkpoint records which URLs have already been probed so that an
+// interrupted scan can be resumed. A nil *checkpoint is valid and
+// records nothing.
+type checkpoint struct {
+	mu   sync.Mutex
+	seen map[string]bool
+	f    *os.File
+}
+
+// openCheckpoint loads any URLs already recorded in the file at path
+// and opens it for appending
+func openCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{seen: make(map[string]bool)}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" {
+			cp.seen[line] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cp.f = f
+	return cp, nil
+}
+
+// done reports whether url was probed in a previous run
+func (cp *checkpoint) done(url string) bool {
+	if cp == nil {
+		return false
+	}
+	return cp.seen[url]
+}
+
+// record appends url to the checkpoint file. Each URL is written
+// as soon as its probe completes so a crash loses very little.
+func (cp *checkpoint) record(url string) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	fmt.Fprintln(cp.f, url)
+}
+
+// Close closes the underlying checkpoint file
+func (cp *checkpoint) Close() error {
+	if cp == nil {
+		return nil
+	}
+	return cp.f.Close()
+}
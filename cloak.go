@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultBotUA is the User-Agent that -compare-ua compares against
+const defaultBotUA = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+// cloakThreshold is the fraction by which the body lengths of the two
+// responses must differ for them to count as different
+const cloakThreshold = 0.1
+
+// compareUA probes url again sending ua as the User-Agent and returns
+// an annotation like [ua-diff: 200 5120B vs 403 312B] if the status or
+// body length differ significantly from res, or the empty string if
+// they don't
+func compareUA(client *http.Client, url string, opts *probeOptions, res *probeResult, ua string) string {
+	o := *opts
+	o.keepBody = false
+	o.noDrain = false
+	o.headers = opts.headers.Clone()
+	if o.headers == nil {
+		o.headers = make(http.Header)
+	}
+	o.headers.Set("User-Agent", ua)
+
+	other, err := isListening(client, url, &o)
+	if err != nil {
+		return fmt.Sprintf("[ua-diff: %d %dB vs %s]", res.resp.StatusCode, res.length, errorCategory(err))
+	}
+	if other.resp.StatusCode == res.resp.StatusCode && !lengthsDiffer(res.length, other.length) {
+		return ""
+	}
+	return fmt.Sprintf("[ua-diff: %d %dB vs %d %dB]", res.resp.StatusCode, res.length, other.resp.StatusCode, other.length)
+}
+
+// lengthsDiffer reports whether a and b differ by more than
+// cloakThreshold of the larger of the two
+func lengthsDiffer(a, b int64) bool {
+	diff, max := a-b, a
+	if diff < 0 {
+		diff, max = -diff, b
+	}
+	return float64(diff) > float64(max)*cloakThreshold
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// lengthClusters groups live URLs by the length of their response
+// body. Many URLs sharing one length often indicates a soft-404
+// or a catch-all page. It is safe for concurrent use.
+type lengthClusters struct {
+	mu       sync.Mutex
+	clusters map[int64]*lengthCluster
+}
+
+type lengthCluster struct {
+	length  int64
+	count   int
+	example string
+}
+
+func newLengthClusters() *lengthClusters {
+	return &lengthClusters{clusters: make(map[int64]*lengthCluster)}
+}
+
+// add records that url had a response body of length bytes
+func (lc *lengthClusters) add(url string, length int64) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	c, ok := lc.clusters[length]
+	if !ok {
+		c = &lengthCluster{length: length, example: url}
+		lc.clusters[length] = c
+	}
+	c.count++
+}
+
+// print writes the n largest clusters containing more than one URL to w
+func (lc *lengthClusters) print(w io.Writer, n int) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	var sorted []*lengthCluster
+	for _, c := range lc.clusters {
+		if c.count > 1 {
+			sorted = append(sorted, c)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].length < sorted[j].length
+	})
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+
+	fmt.Fprintln(w, "content length clusters:")
+	for _, c := range sorted {
+		fmt.Fprintf(w, "  %d bytes: %d URLs (e.g. %s)\n", c.length, c.count, c.example)
+	}
+}
+
+// sizeBuckets are the upper bounds (exclusive) of the body size
+// histogram buckets, other than the first which only holds 0
+var sizeBuckets = [...]struct {
+	label string
+	max   int64
+}{
+	{"0", 1},
+	{"<1KB", 1024},
+	{"<10KB", 10 * 1024},
+	{"<100KB", 100 * 1024},
+	{">=100KB", -1},
+}
+
+// sizeHistogram counts live URLs by the size of their response
+// body. It is safe for concurrent use.
+type sizeHistogram struct {
+	mu     sync.Mutex
+	counts [len(sizeBuckets)]int
+}
+
+// add records a response body of length bytes
+func (h *sizeHistogram) add(length int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range sizeBuckets {
+		if b.max == -1 || length < b.max {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// print writes the histogram to w with bars scaled to 40 characters
+func (h *sizeHistogram) print(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	most := 0
+	for _, c := range h.counts {
+		if c > most {
+			most = c
+		}
+	}
+
+	fmt.Fprintln(w, "body sizes:")
+	for i, b := range sizeBuckets {
+		bar := 0
+		if most > 0 {
+			bar = h.counts[i] * 40 / most
+		}
+		if bar == 0 && h.counts[i] > 0 {
+			bar = 1
+		}
+		fmt.Fprintf(w, "  %-8s %-40s %d\n", b.label, strings.Repeat("#", bar), h.counts[i])
+	}
+}
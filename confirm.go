@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// pendingResults collects results that are waiting to be confirmed
+// by -confirm. It is safe for concurrent use.
+type pendingResults struct {
+	mu      sync.Mutex
+	results []*result
+}
+
+func (p *pendingResults) add(r *result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results = append(p.results, r)
+}
+
+// confirm probes the URL of each pending result n more times using
+// concurrency workers, and returns the results for which a majority
+// of the probes succeeded. The ratio is reported on stderr if verbose.
+func (p *pendingResults) confirm(n, concurrency int, alive func(url string) bool, verbose bool) []*result {
+	jobs := make(chan *result)
+	var mu sync.Mutex
+	var confirmed []*result
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				ok := 0
+				for j := 0; j < n; j++ {
+					if alive(r.url) {
+						ok++
+					}
+				}
+
+				if verbose {
+					fmt.Fprintf(os.Stderr, "confirm: %s (%d/%d)\n", r.url, ok, n)
+				}
+				if ok*2 <= n {
+					continue
+				}
+
+				mu.Lock()
+				confirmed = append(confirmed, r)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, r := range p.results {
+		jobs <- r
+	}
+	close(jobs)
+	wg.Wait()
+
+	return confirmed
+}
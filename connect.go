@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"time"
+)
+
+// dialFunc makes a connection like net.Dialer.DialContext. The same
+// one is used for every probe so that -4, -6 and -dns-cache-ttl apply
+// to the modes that don't use the HTTP transport too.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialTimeout connects to addr over TCP using dial, giving up after timeout
+func dialTimeout(dial dialFunc, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dial(ctx, "tcp", addr)
+}
+
+// acceptsConnect sends an HTTP CONNECT request for target to the
+// host and port in rawurl and returns an error unless the server
+// agrees to open the tunnel, which suggests an open proxy
+func acceptsConnect(dial dialFunc, rawurl, target string, timeout time.Duration) error {
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(u.Hostname(), urlPort(u))
+
+	conn, err := dialTimeout(dial, addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         u.Hostname(),
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("CONNECT refused with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// tcpConnect checks that a TCP connection can be made to the host and
+// port in rawurl, completing a TLS handshake too for https URLs, and
+// returns the address that was connected to. No HTTP request is sent.
+func tcpConnect(dial dialFunc, rawurl string, cfg *tls.Config, timeout time.Duration) (string, error) {
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return "", err
+	}
+	port := urlPort(u)
+	if port == "" {
+		return "", fmt.Errorf("no port for scheme %s", u.Scheme)
+	}
+
+	conn, err := dialTimeout(dial, net.JoinHostPort(u.Hostname(), port), timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	remote := conn.RemoteAddr().String()
+
+	if u.Scheme != "https" {
+		return remote, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+	return remote, tls.Client(conn, cfg).Handshake()
+}
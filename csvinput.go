@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// csvURL builds the URL for one row of -csv-input. The columns are
+// host, port, scheme and path; all but the host are optional. The
+// scheme defaults to http, and the port to the scheme's default.
+func csvURL(line string) (string, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	row, err := r.Read()
+	if err != nil {
+		return "", err
+	}
+
+	col := func(i int) string {
+		if i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	host, port, scheme, path := col(0), col(1), col(2), col(3)
+
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	if !validScheme(scheme) {
+		return "", fmt.Errorf("invalid scheme %q", scheme)
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	// IPv6 addresses need brackets once a port is added
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+
+	if port == "" {
+		return scheme + "://" + host + path, nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+	return scheme + "://" + host + ":" + port + path, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// loadPrevious reads the live URLs from the output of a previous
+// run. Lines may contain annotations, inputs or timestamps so the
+// first field that looks like a URL is used, without any + or -
+// marker from a previous -diff.
+func loadPrevious(path string) (map[string]bool, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prev := make(map[string]bool)
+	for _, line := range lines {
+		for _, field := range strings.Fields(line) {
+			field = strings.TrimLeft(field, "+-")
+			if strings.Contains(field, "://") {
+				prev[field] = true
+				break
+			}
+		}
+	}
+	return prev, nil
+}
+
+// goneResults returns a result, prefixed with a -, for each URL in
+// prev that wasn't seen in this run
+func goneResults(prev map[string]bool, seen *seenSet) []*result {
+	var gone []string
+	for url := range prev {
+		if !seen.has(url) {
+			gone = append(gone, url)
+		}
+	}
+
+	sort.Strings(gone)
+	results := make([]*result, len(gone))
+	for i, url := range gone {
+		results[i] = &result{url: url, line: "-" + url, json: jsonResult{URL: url, Gone: true}}
+	}
+	return results
+}
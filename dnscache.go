@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache caches the results of host lookups for a fixed TTL so
+// that probing many ports on one host only resolves it once. Hosts
+// that don't exist are cached too; other lookup errors aren't. It
+// is safe for concurrent use.
+type dnsCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	entries  map[string]*dnsEntry
+	resolver *net.Resolver
+}
+
+// dnsEntry is a cached lookup. ready is closed once the lookup
+// has finished so that concurrent callers can wait for it.
+type dnsEntry struct {
+	ready   chan struct{}
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:      ttl,
+		entries:  make(map[string]*dnsEntry),
+		resolver: net.DefaultResolver,
+	}
+}
+
+// lookup returns the addresses for host, from the cache if there's
+// an entry that hasn't expired
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Now().After(e.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		e = &dnsEntry{ready: make(chan struct{})}
+		c.entries[host] = e
+		c.mu.Unlock()
+
+		e.addrs, e.err = c.resolver.LookupHost(ctx, host)
+		e.expires = time.Now().Add(c.ttl)
+
+		var dnsErr *net.DNSError
+		if e.err != nil && !(errors.As(e.err, &dnsErr) && dnsErr.IsNotFound) {
+			// don't keep transient failures around
+			e.expires = time.Time{}
+		}
+		close(e.ready)
+		return e.addrs, e.err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return e.addrs, e.err
+}
+
+// dialContext returns a DialContext function for an http.Transport
+// that resolves hosts through the cache and then dials each of the
+// addresses in turn using d
+func (c *dnsCache) dialContext(d *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return d.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var firstErr error
+		for _, a := range addrs {
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(a, port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr == nil {
+			firstErr = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		return nil, firstErr
+	}
+}
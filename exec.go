@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// execMatcher decides whether a result should be output by running a
+// user supplied shell command and checking its exit status. At most
+// cap(sem) commands are run at once.
+type execMatcher struct {
+	command string
+	timeout time.Duration
+	sem     chan struct{}
+}
+
+func newExecMatcher(command string, concurrency int, timeout time.Duration) *execMatcher {
+	return &execMatcher{command: command, timeout: timeout, sem: make(chan struct{}, concurrency)}
+}
+
+// match runs the command with sh -c, passing the URL and status code
+// as $1 and $2 (and as HTTPROBE_URL and HTTPROBE_STATUS) and the
+// response body on stdin, and reports whether it exited with status 0
+func (m *execMatcher) match(res *probeResult) bool {
+	m.sem <- struct{}{}
+	defer func() { <-m.sem }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	status := strconv.Itoa(res.resp.StatusCode)
+	cmd := exec.CommandContext(ctx, "sh", "-c", m.command, "httprobe", res.url, status)
+	cmd.Env = append(os.Environ(), "HTTPROBE_URL="+res.url, "HTTPROBE_STATUS="+status)
+	cmd.Stdin = bytes.NewReader(res.body)
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run() == nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// followReader keeps reading from r after it reports EOF, polling
+// for more data like tail -f. It's used with -follow so that a FIFO
+// whose writers come and go, or a file that's still being appended
+// to, keeps feeding the scan.
+type followReader struct {
+	r        io.Reader
+	interval time.Duration
+
+	// stop, if set, ends the input at the next EOF once it returns true
+	stop func() bool
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		if err == io.EOF {
+			if n > 0 {
+				return n, nil
+			}
+			if f.stop != nil && f.stop() {
+				return 0, io.EOF
+			}
+			time.Sleep(f.interval)
+			continue
+		}
+		return n, err
+	}
+}
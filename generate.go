@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// port templates for use with -p
+var xlarge = []string{"81", "300", "591", "593", "832", "981", "1010", "1311", "2082", "2087", "2095", "2096", "2480", "3000", "3128", "3333", "4243", "4567", "4711", "4712", "4993", "5000", "5104", "5108", "5800", "6543", "7000", "7396", "7474", "8000", "8001", "8008", "8014", "8042", "8069", "8080", "8081", "8088", "8090", "8091", "8118", "8123", "8172", "8222", "8243", "8280", "8281", "8333", "8443", "8500", "8834", "8880", "8888", "8983", "9000", "9043", "9060", "9080", "9090", "9091", "9200", "9443", "9800", "9981", "12443", "16080", "18091", "18092", "20720", "28017"}
+var large = []string{"81", "591", "2082", "2087", "2095", "2096", "3000", "8000", "8001", "8008", "8080", "8083", "8443", "8834", "8888"}
+
+// printTemplates writes the name and ports of each port template to w
+func printTemplates(w io.Writer) {
+	fmt.Fprintf(w, "large: %s\n", strings.Join(large, ","))
+	fmt.Fprintf(w, "xlarge: %s\n", strings.Join(xlarge, ","))
+}
+
+// generator builds the URLs to be probed for each input domain
+type generator struct {
+	// skipDefault skips the http:80 and https:443 probes
+	skipDefault bool
+
+	// probes are the additional probes from -p
+	probes probeArgs
+
+	// schemes are used for the default probes and port templates
+	schemes []string
+
+	// portSchemes pins template ports to a single scheme
+	portSchemes map[string]string
+
+	// only restricts every probe to a single scheme when set
+	only string
+
+	// trimPath collapses duplicate slashes in the URL path
+	trimPath bool
+}
+
+// target is a URL to be probed along with the input line it came
+// from and the probe that generated it, e.g. default or xlarge:8080
+type target struct {
+	url   string
+	input string
+	probe string
+}
+
+// submit sends every URL that should be probed for domain
+// to the urls channel, tagged with the input line
+func (g *generator) submit(urls chan<- target, input, domain string) {
+	// the input can include a path and query string, which
+	// must come after any port that's added
+	host, rest := splitHost(domain)
+
+	send := func(scheme, port, probe string) {
+		if g.only != "" && scheme != g.only {
+			return
+		}
+
+		url := scheme + "://" + host + rest
+		if port != "" {
+			url = fmt.Sprintf("%s://%s:%s%s", scheme, host, port, rest)
+		}
+		if g.trimPath {
+			url = collapseSlashes(url)
+		}
+		urls <- target{url: url, input: input, probe: probe}
+	}
+
+	// submit a version for each scheme to be checked
+	if !g.skipDefault {
+		for _, scheme := range g.schemes {
+			send(scheme, "", "default")
+		}
+	}
+
+	// submit any additional proto:port probes
+	for _, p := range g.probes {
+		switch p {
+		case "xlarge":
+			for _, port := range xlarge {
+				for _, scheme := range g.portScheme(port) {
+					send(scheme, port, "xlarge:"+port)
+				}
+			}
+		case "large":
+			for _, port := range large {
+				for _, scheme := range g.portScheme(port) {
+					send(scheme, port, "large:"+port)
+				}
+			}
+		default:
+			pair := strings.SplitN(p, ":", 2)
+			if len(pair) != 2 {
+				continue
+			}
+			ports, err := parsePortRange(pair[1])
+			if err != nil {
+				continue
+			}
+			for _, port := range ports {
+				send(pair[0], port, p)
+			}
+		}
+	}
+}
+
+// defaultProbes returns the number of default probes made for each
+// input domain, taking -s and -only into account
+func (g *generator) defaultProbes() int {
+	if g.skipDefault {
+		return 0
+	}
+	n := 0
+	for _, scheme := range g.schemes {
+		if g.only == "" || scheme == g.only {
+			n++
+		}
+	}
+	return n
+}
+
+// portScheme returns the schemes to use for a template port:
+// the one from -port-scheme if the port is mapped, or all of them
+func (g *generator) portScheme(port string) []string {
+	if s, ok := g.portSchemes[port]; ok {
+		return []string{s}
+	}
+	return g.schemes
+}
+
+// parsePortSchemes parses a mapping of ports to schemes in
+// the form 8080=http,8443=https
+func parsePortSchemes(raw string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !validScheme(parts[1]) {
+			return nil, fmt.Errorf("invalid port scheme mapping: %s", pair)
+		}
+		if _, err := strconv.Atoi(parts[0]); err != nil {
+			return nil, fmt.Errorf("invalid port in scheme mapping: %s", parts[0])
+		}
+		out[parts[0]] = strings.ToLower(parts[1])
+	}
+	return out, nil
+}
+
+// parseSchemes splits the comma separated values given to -scheme,
+// returning http and https when none were given
+func parseSchemes(args []string) ([]string, error) {
+	var schemes []string
+	for _, arg := range args {
+		for _, s := range strings.Split(arg, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if !validScheme(s) {
+				return nil, fmt.Errorf("invalid scheme %q", s)
+			}
+			schemes = append(schemes, s)
+		}
+	}
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	return schemes, nil
+}
+
+// validScheme reports whether s is a URL scheme as described by
+// RFC 3986: a letter followed by letters, digits, '+', '-' or '.'
+func validScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// splitHost splits an input line into the host and anything
+// following it: the path, query string and fragment. The rest
+// is kept exactly as given rather than being re-encoded.
+func splitHost(domain string) (string, string) {
+	i := strings.IndexAny(domain, "/?#")
+	if i == -1 {
+		return domain, ""
+	}
+	return domain[:i], domain[i:]
+}
+
+// wwwVariant returns the www. form of domain, or an empty string when
+// domain already starts with www. or is an IP address
+func wwwVariant(domain string) string {
+	host, _ := splitHost(domain)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.HasPrefix(host, "www.") || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return ""
+	}
+	return "www." + domain
+}
+
+// collapseSlashes replaces runs of slashes in the path of rawurl with
+// a single slash. The scheme separator, query string and fragment are
+// left alone, and unlike path.Clean dot segments aren't resolved.
+func collapseSlashes(rawurl string) string {
+	start := strings.Index(rawurl, "://")
+	if start == -1 {
+		return rawurl
+	}
+	start += 3
+
+	end := len(rawurl)
+	if i := strings.IndexAny(rawurl[start:], "?#"); i != -1 {
+		end = start + i
+	}
+
+	p := rawurl[start:end]
+	for strings.Contains(p, "//") {
+		p = strings.Replace(p, "//", "/", -1)
+	}
+	return rawurl[:start] + p + rawurl[end:]
+}
+
+// parsePortRange expands a port spec in the form start-end into
+// each port in the inclusive range. A spec that isn't a range is
+// returned as-is.
+func parsePortRange(spec string) ([]string, error) {
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 {
+		return []string{spec}, nil
+	}
+
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid port range: %s", spec)
+	}
+	end, err := strconv.Atoi(bounds[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid port range: %s", spec)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return nil, fmt.Errorf("invalid port range: %s", spec)
+	}
+
+	ports := make([]string, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	return ports, nil
+}
+
+// checkProbes warns about and removes any probes with an invalid port range
+func checkProbes(probes probeArgs) probeArgs {
+	var valid probeArgs
+	for _, p := range probes {
+		pair := strings.SplitN(p, ":", 2)
+		if len(pair) == 2 {
+			if _, err := parsePortRange(pair[1]); err != nil {
+				fmt.Fprintf(os.Stderr, "skipping probe %s: %s\n", p, err)
+				continue
+			}
+		}
+		valid = append(valid, p)
+	}
+	return valid
+}
@@ -0,0 +1,15 @@
+module github.com/tomnomnom/httprobe
+
+go 1.24.0
+
+require (
+	github.com/quic-go/quic-go v0.59.0
+	golang.org/x/net v0.50.0
+)
+
+require (
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/crypto v0.48.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
+	golang.org/x/text v0.34.0 // indirect
+)
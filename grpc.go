@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// grpcPorts is the set of ports given to -grpc
+type grpcPorts map[string]bool
+
+// parseGRPCPorts parses a comma separated list of ports and ranges
+func parseGRPCPorts(s string) (grpcPorts, error) {
+	ports := make(grpcPorts)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pr, err := parsePortRange(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -grpc port %s: %s", part, err)
+		}
+		for _, p := range pr {
+			ports[p] = true
+		}
+	}
+	return ports, nil
+}
+
+// match reports whether rawurl is on one of the gRPC ports
+func (g grpcPorts) match(rawurl string) bool {
+	if len(g) == 0 {
+		return false
+	}
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return false
+	}
+	return g[urlPort(u)]
+}
+
+// grpcServingStatus names the values of HealthCheckResponse.status
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// grpcHealthCheck calls the standard grpc.health.v1.Health/Check
+// method on the host in rawurl, over h2c for http URLs and HTTP/2
+// over TLS otherwise, and returns the serving status. client must
+// be configured to speak HTTP/2 only.
+func grpcHealthCheck(client *http.Client, rawurl string) (string, error) {
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" {
+		u.Scheme = "https"
+	}
+	u.Path = "/grpc.health.v1.Health/Check"
+	u.RawQuery = ""
+
+	// an empty HealthCheckRequest in a single uncompressed frame
+	frame := []byte{0, 0, 0, 0, 0}
+
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(frame))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("grpc: HTTP status %d", resp.StatusCode)
+	}
+
+	// errors can come in the headers for a trailers-only response
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		return "", fmt.Errorf("grpc: status %q", status)
+	}
+
+	if len(body) < 5 {
+		return "", errors.New("grpc: short response")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	msg := body[5:]
+	if uint32(len(msg)) < n {
+		return "", errors.New("grpc: short response")
+	}
+	return parseHealthStatus(msg[:n]), nil
+}
+
+// parseHealthStatus decodes the status field (1, a varint) from an
+// encoded HealthCheckResponse. A missing field is the zero value.
+func parseHealthStatus(msg []byte) string {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			break
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return grpcServingStatus[0]
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				if s, ok := grpcServingStatus[v]; ok {
+					return s
+				}
+				return fmt.Sprintf("%d", v)
+			}
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return grpcServingStatus[0]
+			}
+			msg = msg[n+int(l):]
+		default:
+			return grpcServingStatus[0]
+		}
+	}
+	return grpcServingStatus[0]
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"time"
+)
+
+// headBodySize sends a HEAD request for rawurl over a raw connection
+// and returns the number of bytes the server sent after the headers,
+// which should always be zero. net/http can't be used for this as it
+// never reads a body in response to HEAD.
+func headBodySize(dial dialFunc, rawurl string, cfg *tls.Config, timeout time.Duration) (int64, error) {
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return 0, err
+	}
+	port := urlPort(u)
+	if port == "" {
+		return 0, fmt.Errorf("no port for scheme %s", u.Scheme)
+	}
+
+	conn, err := dialTimeout(dial, net.JoinHostPort(u.Hostname(), port), timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if u.Scheme == "https" {
+		cfg = cfg.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		// the raw request is always HTTP/1.1
+		cfg.NextProtos = nil
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			return 0, err
+		}
+		conn = tlsConn
+	}
+
+	fmt.Fprintf(conn, "HEAD %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", u.RequestURI(), u.Host)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: "HEAD"})
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	// anything else before the server closes the connection is a body;
+	// a server that keeps the connection open anyway hits the deadline
+	n, _ := io.Copy(io.Discard, br)
+	return n, nil
+}
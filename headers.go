@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// headerPool holds lists of values for request headers. Each request
+// gets a randomly chosen value for every header in the pool. It is
+// safe for concurrent use.
+type headerPool struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	values map[string][]string
+
+	// names are the headers in the order they were loaded, so
+	// that values are drawn in the same order for a given seed
+	names []string
+}
+
+func newHeaderPool(seed int64) *headerPool {
+	return &headerPool{
+		rng:    rand.New(rand.NewSource(seed)),
+		values: make(map[string][]string),
+	}
+}
+
+// load reads the possible values for the header name from the
+// lines of the file at path
+func (hp *headerPool) load(name, path string) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("no values for %s in %s", name, path)
+	}
+	name = http.CanonicalHeaderKey(name)
+	if _, ok := hp.values[name]; !ok {
+		hp.names = append(hp.names, name)
+	}
+	hp.values[name] = lines
+	return nil
+}
+
+// apply sets a randomly chosen value for each header in the pool on h
+func (hp *headerPool) apply(h http.Header) {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+
+	for _, name := range hp.names {
+		vals := hp.values[name]
+		h.Set(name, vals[hp.rng.Intn(len(vals))])
+	}
+}
+
+// parseRandomHeader parses a -rand-header argument in the form Name=file
+func parseRandomHeader(arg string) (string, string, error) {
+	pair := strings.SplitN(arg, "=", 2)
+	if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" || pair[1] == "" {
+		return "", "", fmt.Errorf("invalid random header: %s", arg)
+	}
+	return strings.TrimSpace(pair[0]), pair[1], nil
+}
+
+// profileHeader is a header in the HAR form of a -profile file
+type profileHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// loadProfile reads a -profile file of request headers. It can be a
+// JSON object mapping header names to values, or a HAR-style array of
+// objects with name and value fields, such as the headers of a request
+// copied from a browser's developer tools. HTTP/2 pseudo-headers and
+// headers that are specific to one request or connection are ignored.
+func loadProfile(path string) (http.Header, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []profileHeader
+	if err := json.Unmarshal(data, &list); err != nil {
+		var m map[string]string
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%s: want an object of header values or an array of {\"name\", \"value\"} objects", path)
+		}
+		for name, value := range m {
+			list = append(list, profileHeader{Name: name, Value: value})
+		}
+	}
+
+	out := make(http.Header)
+	for i, h := range list {
+		name := strings.TrimSpace(h.Name)
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("%s: invalid header name %q in entry %d", path, h.Name, i+1)
+		}
+		if strings.HasPrefix(name, ":") {
+			continue
+		}
+		switch http.CanonicalHeaderKey(name) {
+		// an explicit Accept-Encoding stops net/http decompressing
+		// responses, which would break the body filters
+		case "Host", "Connection", "Content-Length", "Cookie", "Accept-Encoding":
+			continue
+		}
+		out.Add(name, h.Value)
+	}
+	return out, nil
+}
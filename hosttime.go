@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// hostTimer tracks the cumulative time spent probing each host so
+// that a host whose ports all hang can't dominate a scan. A nil
+// hostTimer has no limit. It is safe for concurrent use.
+type hostTimer struct {
+	mu    sync.Mutex
+	limit time.Duration
+	spent map[string]time.Duration
+}
+
+func newHostTimer(limit time.Duration) *hostTimer {
+	return &hostTimer{limit: limit, spent: make(map[string]time.Duration)}
+}
+
+// add records that d was spent probing host
+func (t *hostTimer) add(host string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spent[host] += d
+}
+
+// exceeded reports whether more than the limit has been spent on host
+func (t *hostTimer) exceeded(host string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spent[host] > t.limit
+}
+
+// refusedHosts counts the default probes for each host that had
+// their connection refused, so that -fail-fast can skip the rest
+// of the host's probes once all of them have been. A nil
+// refusedHosts never reports a host as dead. It is safe for
+// concurrent use.
+type refusedHosts struct {
+	mu     sync.Mutex
+	need   int
+	counts map[string]int
+}
+
+func newRefusedHosts(need int) *refusedHosts {
+	return &refusedHosts{need: need, counts: make(map[string]int)}
+}
+
+// add records a refused default probe for host
+func (r *refusedHosts) add(host string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[host]++
+}
+
+// dead reports whether all of the default probes for host were refused
+func (r *refusedHosts) dead(host string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[host] >= r.need
+}
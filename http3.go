@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Client returns a client that makes requests over HTTP/3
+// (QUIC) using a copy of cfg. Hosts are resolved with lookup and only
+// addresses usable with network (udp, udp4 or udp6) are connected to.
+// dialTimeout limits the QUIC handshake.
+func newHTTP3Client(cfg *tls.Config, lookup func(context.Context, string) ([]string, error), network string, dialTimeout, timeout time.Duration, checkRedirect func(*http.Request, []*http.Request) error) *http.Client {
+	d := &quicDialer{lookup: lookup, network: network}
+	return &http.Client{
+		CheckRedirect: checkRedirect,
+		Transport: &http3.Transport{
+			TLSClientConfig: cfg.Clone(),
+			QUICConfig:      &quic.Config{HandshakeIdleTimeout: dialTimeout},
+			Dial:            d.dial,
+		},
+		Timeout: timeout,
+	}
+}
+
+// quicDialer makes QUIC connections from a single UDP socket, opened
+// on first use, resolving hosts the same way as the TCP probes
+type quicDialer struct {
+	lookup  func(context.Context, string) ([]string, error)
+	network string
+
+	mu sync.Mutex
+	tr *quic.Transport
+}
+
+func (d *quicDialer) dial(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		ips, err = d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			continue
+		}
+		is4 := ip.To4() != nil
+		if d.network == "udp4" && !is4 || d.network == "udp6" && is4 {
+			continue
+		}
+
+		tr, err := d.transport()
+		if err != nil {
+			return nil, err
+		}
+		port, err := net.LookupPort("udp", port)
+		if err != nil {
+			return nil, err
+		}
+		return tr.DialEarly(ctx, &net.UDPAddr{IP: ip, Port: port}, tlsCfg, cfg)
+	}
+	return nil, fmt.Errorf("no suitable address for %s", host)
+}
+
+// transport returns the shared QUIC transport, opening its socket
+// the first time it's needed
+func (d *quicDialer) transport() (*quic.Transport, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tr != nil {
+		return d.tr, nil
+	}
+	conn, err := net.ListenUDP(d.network, nil)
+	if err != nil {
+		return nil, err
+	}
+	d.tr = &quic.Transport{Conn: conn}
+	return d.tr, nil
+}
+
+// probeURL probes url with client. When h3 is set https URLs are
+// tried over HTTP/3 first, falling back to client for hosts that
+// don't answer over QUIC. The HTTP/3 attempt is made only once;
+// retries are left to the TCP fallback.
+func probeURL(client, h3 *http.Client, url string, opts *probeOptions, verbose bool) (*probeResult, error) {
+	if h3 != nil && strings.HasPrefix(url, "https://") {
+		res, err := probeOnce(h3, url, opts)
+		if err == nil {
+			return res, nil
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "no HTTP/3: %s (%s)\n", url, errorCategory(err))
+		}
+	}
+	return isListening(client, url, opts)
+}
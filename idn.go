@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// asciiURL converts the host of rawurl to its ASCII (punycode) form
+// using the IDNA lookup rules, so that it can be requested. URLs with
+// an ASCII host, or a host that isn't a valid IDN, are returned
+// unchanged.
+func asciiURL(rawurl string) string {
+	start := strings.Index(rawurl, "://")
+	if start == -1 {
+		return rawurl
+	}
+	start += 3
+
+	end := len(rawurl)
+	if i := strings.IndexAny(rawurl[start:], "/?#"); i != -1 {
+		end = start + i
+	}
+
+	host := rawurl[start:end]
+	if isASCII(host) {
+		return rawurl
+	}
+
+	// leave any port alone
+	port := ""
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host, port = host[:i], host[i:]
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return rawurl
+	}
+	return rawurl[:start] + ascii + port + rawurl[end:]
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
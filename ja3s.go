@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecorded caps how much of a TLS handshake is recorded
+const maxRecorded = 64 * 1024
+
+// recordingConn keeps a copy of the first bytes read from a connection
+type recordingConn struct {
+	net.Conn
+	read []byte
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if len(c.read) < maxRecorded {
+		c.read = append(c.read, p[:n]...)
+	}
+	return n, err
+}
+
+// ja3s makes a TLS handshake with the host in rawurl and returns a
+// JA3S fingerprint of its ServerHello: the MD5 of the version, cipher
+// suite and extension types. The handshake doesn't have to succeed
+// as long as a ServerHello was received.
+func ja3s(dial dialFunc, rawurl string, cfg *tls.Config, timeout time.Duration) (string, error) {
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return "", err
+	}
+	rc := &recordingConn{Conn: conn}
+	tc := tls.Client(rc, cfg)
+	defer tc.Close()
+	herr := tc.HandshakeContext(ctx)
+
+	version, cipher, exts, err := parseServerHello(rc.read)
+	if err != nil {
+		if herr != nil {
+			return "", herr
+		}
+		return "", err
+	}
+
+	types := make([]string, len(exts))
+	for i, e := range exts {
+		types[i] = strconv.Itoa(int(e))
+	}
+	sum := md5.Sum([]byte(fmt.Sprintf("%d,%d,%s", version, cipher, strings.Join(types, "-"))))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+var errNoServerHello = errors.New("no ServerHello received")
+
+// parseServerHello extracts the version, cipher suite and extension
+// types from the ServerHello at the start of data, which holds the
+// raw TLS records sent by a server
+func parseServerHello(data []byte) (uint16, uint16, []uint16, error) {
+	// join the payloads of the leading handshake records, since a
+	// handshake message can be split across several of them
+	var hs []byte
+	for len(data) >= 5 && data[0] == 22 {
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+n {
+			break
+		}
+		hs = append(hs, data[5:5+n]...)
+		data = data[5+n:]
+	}
+
+	if len(hs) < 4 || hs[0] != 2 {
+		return 0, 0, nil, errNoServerHello
+	}
+	n := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3])
+	if len(hs) < 4+n {
+		return 0, 0, nil, errNoServerHello
+	}
+	b := hs[4 : 4+n]
+
+	// version (2), random (32), session id (1 + length)
+	if len(b) < 35 {
+		return 0, 0, nil, errNoServerHello
+	}
+	version := binary.BigEndian.Uint16(b)
+	b = b[34:]
+	sid := int(b[0])
+	if len(b) < 1+sid+3 {
+		return 0, 0, nil, errNoServerHello
+	}
+	b = b[1+sid:]
+
+	// cipher suite (2), compression method (1)
+	cipher := binary.BigEndian.Uint16(b)
+	b = b[3:]
+
+	var exts []uint16
+	if len(b) >= 2 {
+		total := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) > total {
+			b = b[:total]
+		}
+		for len(b) >= 4 {
+			exts = append(exts, binary.BigEndian.Uint16(b))
+			l := int(binary.BigEndian.Uint16(b[2:]))
+			if len(b) < 4+l {
+				break
+			}
+			b = b[4+l:]
+		}
+	}
+	return version, cipher, exts, nil
+}
@@ -2,15 +2,20 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,23 +30,166 @@ func (p probeArgs) String() string {
 	return strings.Join(p, ",")
 }
 
+type headerArgs []string
+
+func (h *headerArgs) Set(val string) error {
+	*h = append(*h, val)
+	return nil
+}
+
+func (h headerArgs) String() string {
+	return strings.Join(h, ",")
+}
+
+// parse converts the raw "Name: value" arguments into an http.Header
+func (h headerArgs) parse() (http.Header, error) {
+	out := make(http.Header)
+	for _, raw := range h {
+		pair := strings.SplitN(raw, ":", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, fmt.Errorf("invalid header: %s", raw)
+		}
+		out.Add(strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1]))
+	}
+	return out, nil
+}
+
+// durationArg is a duration flag that also accepts a bare
+// number of milliseconds, for compatibility with older versions
+type durationArg time.Duration
+
+func (d *durationArg) Set(val string) error {
+	if ms, err := strconv.Atoi(val); err == nil {
+		*d = durationArg(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+	v, err := time.ParseDuration(val)
+	if err != nil {
+		return err
+	}
+	*d = durationArg(v)
+	return nil
+}
+
+func (d durationArg) String() string {
+	return time.Duration(d).String()
+}
+
+// exit codes
+const (
+	exitAlive     = 0 // at least one URL was output
+	exitNoneAlive = 1 // no URLs were output
+	exitError     = 2 // input/output error, bad arguments or aborted scan
+)
+
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 
 	// concurrency flag
 	var concurrency int
 	flag.IntVar(&concurrency, "c", 50, "set the concurrency level")
 
+	// input buffer flag
+	var buffer int
+	flag.IntVar(&buffer, "buffer", 0, "number of URLs to queue ahead of the workers")
+
+	// transport isolation flag
+	var isolate bool
+	flag.BoolVar(&isolate, "isolate-transports", false, "give each worker its own HTTP transport instead of sharing one")
+
 	// probe flags
 	var probes probeArgs
 	flag.Var(&probes, "p", "add additional probe (proto:port)")
 
+	// list templates flag
+	var listTemplates bool
+	flag.BoolVar(&listTemplates, "list-templates", false, "print the ports in each -p template (large, xlarge) and exit")
+
 	// skip default probes flag
 	var skipDefault bool
 	flag.BoolVar(&skipDefault, "s", false, "skip the default probes (http:80 and https:443)")
 
+	// scheme flag
+	var schemeArgs probeArgs
+	flag.Var(&schemeArgs, "scheme", "scheme to use for the default probes and port templates (repeatable, default http,https)")
+
+	// port scheme flag
+	var portSchemeMap string
+	flag.StringVar(&portSchemeMap, "port-scheme", "", "only use one scheme for some template ports (e.g. 8080=http,8443=https)")
+
+	// only scheme flag
+	var only string
+	flag.StringVar(&only, "only", "", "only generate probes using this scheme")
+
 	// timeout flag
-	var to int
-	flag.IntVar(&to, "t", 10000, "timeout (milliseconds)")
+	to := durationArg(10 * time.Second)
+	flag.Var(&to, "t", "timeout (a duration like 10s, or milliseconds)")
+
+	// dial timeout flag
+	var dialTo durationArg
+	flag.Var(&dialTo, "dt", "connection timeout (a duration or milliseconds, defaults to the -t value)")
+
+	// timeout multiplier flag
+	timeoutMult := 1.0
+	flag.Float64Var(&timeoutMult, "timeout-multiplier", 1.0, "multiply every timeout (-t, -dt, -expect-continue-timeout) by this factor, e.g. 2 on a slow network")
+
+	// dns cache flag
+	var dnsTTL durationArg
+	flag.Var(&dnsTTL, "dns-cache-ttl", "cache DNS lookups (including missing hosts) for this long (e.g. 5m)")
+
+	// address family flags
+	var ipv4Only bool
+	flag.BoolVar(&ipv4Only, "4", false, "only connect over IPv4")
+
+	var ipv6Only bool
+	flag.BoolVar(&ipv6Only, "6", false, "only connect over IPv6")
+
+	// max errors flag
+	var maxErrors int
+	flag.IntVar(&maxErrors, "max-errors", 0, "abort the scan after this many consecutive failed probes")
+
+	// per-host time limit flag
+	var maxHostTime int
+	flag.IntVar(&maxHostTime, "max-host-time", 0, "skip a host's remaining probes once this many milliseconds have been spent on it")
+
+	// fail fast flag
+	var failFast bool
+	flag.BoolVar(&failFast, "fail-fast", false, "skip a host's other probes once all of its default probes have had their connection refused")
+
+	// scope flag
+	var scope string
+	flag.StringVar(&scope, "scope", "", "only probe hosts whose addresses are all public or all private")
+
+	// throttle flag
+	var throttle429 bool
+	flag.BoolVar(&throttle429, "throttle-on-429", false, "slow down probing of hosts that respond with 429 (or 503 with Retry-After)")
+
+	// confirmation flag
+	var confirm int
+	flag.IntVar(&confirm, "confirm", 0, "re-probe live URLs this many more times at the end and only output those that mostly succeed")
+
+	// retry flags
+	var timeoutRetries int
+	flag.IntVar(&timeoutRetries, "timeout-retries", 0, "number of times to retry a probe that timed out")
+
+	var connRetries int
+	flag.IntVar(&connRetries, "conn-retries", 0, "number of times to retry a probe whose connection was refused or reset")
+
+	var backoffStrategy string
+	flag.StringVar(&backoffStrategy, "backoff", "constant", "delay strategy between retries (constant, linear or exponential)")
+
+	var backoffDelay int
+	flag.IntVar(&backoffDelay, "backoff-delay", 0, "base delay before retrying a probe (milliseconds)")
+
+	var backoffMax int
+	flag.IntVar(&backoffMax, "backoff-max", 10000, "maximum total delay between the retries of a probe (milliseconds)")
+
+	// hang detection flag
+	var hangDetect bool
+	flag.BoolVar(&hangDetect, "slowloris-detect", false, "output URLs that accept a connection but never respond, labelled with hang")
 
 	// verbose flag
 	var verbose bool
@@ -54,17 +202,605 @@ func main() {
 	var redirectEndpoint bool
 	flag.BoolVar(&redirectEndpoint, "e", false, "Print redirect endpoint")
 
+	// ALPN flags
+	var alpnH2 bool
+	flag.BoolVar(&alpnH2, "h2", false, "offer HTTP/2 (h2) during the TLS handshake")
+
+	var noHTTP1 bool
+	flag.BoolVar(&noHTTP1, "no-http1", false, "don't offer HTTP/1.1 during the TLS handshake (requires -h2)")
+
+	// http3 flag
+	var useHTTP3 bool
+	flag.BoolVar(&useHTTP3, "http3", false, "probe https URLs over HTTP/3 (QUIC) first, falling back to TCP, and print the protocol used")
+
+	// distinct title flag
+	var distinctTitle bool
+	flag.BoolVar(&distinctTitle, "distinct-title", false, "only output the first URL seen for each unique page title")
+
+	// first only flag
+	var firstOnly bool
+	flag.BoolVar(&firstOnly, "first-only", false, "only output the first live URL for each host and skip its remaining probes")
+
+	// unique ip flag
+	var uniqueIP bool
+	flag.BoolVar(&uniqueIP, "unique-ip", false, "only output the first live URL for each IP address connected to")
+
+	// redirect filter flag
+	var onlyRedirects bool
+	flag.BoolVar(&onlyRedirects, "only-redirects", false, "only output URLs that respond with a redirect")
+
+	// wildcard DNS flag
+	var wildcard bool
+	flag.BoolVar(&wildcard, "wildcard-filter", false, "suppress results that look like they're served by a wildcard DNS record")
+
+	// parked domain flag
+	var dropParked bool
+	flag.BoolVar(&dropParked, "drop-parked", false, "suppress results that look like parked or for-sale domains")
+
+	// header presence flag
+	var hasHeaders headerArgs
+	flag.Var(&hasHeaders, "has-header", "only output URLs whose response has this header (name or name=value, repeatable)")
+
+	var headerInsensitive bool
+	flag.BoolVar(&headerInsensitive, "header-ci", false, "compare -has-header values case-insensitively")
+
+	// response time flags
+	var responseTime bool
+	flag.BoolVar(&responseTime, "rt", false, "print the response time of each URL")
+
+	var slow int
+	flag.IntVar(&slow, "slow", 0, "only output URLs whose time to first byte exceeds this many milliseconds")
+
+	// fast host flag
+	var fast int
+	flag.IntVar(&fast, "fast", 0, "only output URLs that respond in less than this many milliseconds")
+
+	// match string flags
+	var matchString string
+	flag.StringVar(&matchString, "ms", "", "only output URLs whose response body contains this string")
+
+	var matchInsensitive bool
+	flag.BoolVar(&matchInsensitive, "msi", false, "make the -ms match case-insensitive")
+
+	// method flag
+	var method string
+	flag.StringVar(&method, "m", "", "HTTP method to use (default GET, or POST with -data)")
+
+	// random header flags
+	var uaFile string
+	flag.StringVar(&uaFile, "ua-file", "", "file of User-Agent strings to choose from at random for each request")
+
+	var randHeaders headerArgs
+	flag.Var(&randHeaders, "rand-header", "file of values to choose from at random for a header (Name=file, repeatable)")
+
+	// netrc flag
+	var useNetrc bool
+	flag.BoolVar(&useNetrc, "netrc", false, "send basic auth credentials from ~/.netrc (or $NETRC) for matching hosts")
+
+	// per-port method flag
+	var hostMethodMap string
+	flag.StringVar(&hostMethodMap, "host-method-map", "", "use different methods for some ports (e.g. 8080=GET,9000=POST)")
+
+	// method enumeration flag
+	var methodList string
+	flag.StringVar(&methodList, "methods", "", "also send each of these methods (e.g. GET,POST,OPTIONS) to live URLs and annotate the status for each")
+
+	// head body check flag
+	var headBodyCheck bool
+	flag.BoolVar(&headBodyCheck, "head-body-check", false, "with -m HEAD, annotate URLs that wrongly send a body in response to HEAD")
+
+	// ja3s flag
+	var ja3sPrint bool
+	flag.BoolVar(&ja3sPrint, "ja3s", false, "annotate HTTPS results with a JA3S fingerprint of the server's TLS handshake")
+
+	// request body flag
+	var data string
+	flag.StringVar(&data, "data", "", "request body to send (use @file to read it from a file)")
+
+	// expect continue flags
+	var expectContinue bool
+	flag.BoolVar(&expectContinue, "expect-continue", false, "with -data, send Expect: 100-continue and wait for the server before sending the body")
+
+	expectContinueTo := durationArg(time.Second)
+	flag.Var(&expectContinueTo, "expect-continue-timeout", "how long to wait for a 100 Continue before sending the body anyway")
+
+	// header flag
+	var headers headerArgs
+	flag.Var(&headers, "H", "add a request header (Name: value)")
+
+	// header profile flag
+	var profile string
+	flag.StringVar(&profile, "profile", "", "JSON file of request headers (e.g. a browser profile) to send with every probe; -H takes precedence")
+
+	// referer flags
+	var referer string
+	flag.StringVar(&referer, "referer", "", "send this Referer header with every probe")
+
+	var autoReferer bool
+	flag.BoolVar(&autoReferer, "auto-referer", false, "send the root of each probed URL as its Referer header")
+
+	// certificate expiry flag
+	var certExpiry int
+	flag.IntVar(&certExpiry, "cert-expiry", 0, "annotate HTTPS results whose certificate expires within this many days")
+
+	// weak TLS flag
+	var tlsReport bool
+	flag.BoolVar(&tlsReport, "min-tls-report", false, "annotate HTTPS results using TLS older than 1.2 or weak cipher suites")
+
+	// cipher suite flag
+	var ciphers string
+	flag.StringVar(&ciphers, "ciphers", "", "only offer these TLS 1.0-1.2 cipher suites (comma separated Go/IANA names)")
+
+	// sni flag
+	var sni string
+	flag.StringVar(&sni, "sni", "", "server name to send in the TLS handshake instead of the URL's host")
+
+	// tls probe flag
+	var tlsProbe bool
+	flag.BoolVar(&tlsProbe, "tls-probe", false, "only perform a TLS handshake, without an HTTP request, and report certificate details")
+
+	// tcp only flag
+	var tcpOnly bool
+	flag.BoolVar(&tcpOnly, "tcp-only", false, "treat any URL that accepts a TCP connection (and TLS handshake for https) as alive, without an HTTP request")
+
+	// grpc flag
+	var grpcPortList string
+	flag.StringVar(&grpcPortList, "grpc", "", "ports (e.g. 50051,9000-9010) to send a gRPC health check to instead of an HTTP request")
+
+	// websocket flag
+	var websocket bool
+	flag.BoolVar(&websocket, "ws", false, "send a WebSocket upgrade handshake and only output URLs that respond with 101 Switching Protocols")
+
+	// input case flag
+	var noLower bool
+	flag.BoolVar(&noLower, "no-lower", false, "don't lowercase input lines")
+
+	// path normalisation flag
+	var trimPath bool
+	flag.BoolVar(&trimPath, "trim-path", false, "collapse duplicate slashes in the path of each URL")
+
+	// subdomain wordlist flag
+	var subFile string
+	flag.StringVar(&subFile, "sub-file", "", "file of subdomain labels to prepend to each input domain")
+
+	// www variant flag
+	var www bool
+	flag.BoolVar(&www, "www", false, "also probe the www. variant of each input domain")
+
+	// nmap input flag
+	var nmapInput bool
+	flag.BoolVar(&nmapInput, "nmap", false, "read Nmap/masscan greppable output (-oG) on stdin")
+
+	// follow input flag
+	var follow bool
+	flag.BoolVar(&follow, "follow", false, "keep reading stdin after EOF (e.g. from a FIFO) until interrupted")
+
+	// replay flag
+	var replayFile string
+	flag.StringVar(&replayFile, "replay", "", "probe the full URLs in this file (e.g. failures from -v) instead of reading domains on stdin")
+
+	// csv input flags
+	var csvInput bool
+	flag.BoolVar(&csvInput, "csv-input", false, "read host,port,scheme,path rows on stdin and make exactly one probe for each")
+
+	var csvHeader bool
+	flag.BoolVar(&csvHeader, "csv-header", false, "skip the first row of -csv-input")
+
+	// robots flag
+	var robots bool
+	flag.BoolVar(&robots, "robots", false, "skip URLs with paths disallowed by the host's robots.txt")
+
+	// sampling flags
+	var sample float64
+	flag.Float64Var(&sample, "sample", 1, "only probe this fraction (0.0-1.0) or percentage of input lines")
+
+	// randomize input flag
+	var randomize bool
+	flag.BoolVar(&randomize, "randomize-input", false, "read all input first and probe the generated URLs in a random order (see -seed)")
+
+	var seed int64
+	flag.Int64Var(&seed, "seed", 0, "seed for random choices (default is based on the current time)")
+
+	// content length cluster flag
+	var clusterCL int
+	flag.IntVar(&clusterCL, "cluster-cl", 0, "print the N largest groups of live URLs sharing a content length at the end")
+
+	// body size histogram flag
+	var sizeHist bool
+	flag.BoolVar(&sizeHist, "body-size-histogram", false, "print a histogram of the response body sizes of live URLs at the end")
+
+	// CONNECT flags
+	var connectMode bool
+	flag.BoolVar(&connectMode, "connect", false, "only output URLs that accept an HTTP CONNECT request (open proxies)")
+
+	var connectTarget string
+	flag.StringVar(&connectTarget, "connect-target", "example.com:443", "host:port to ask for a tunnel to with -connect")
+
+	// resume flag
+	var resume string
+	flag.StringVar(&resume, "resume", "", "checkpoint file used to skip URLs probed by a previous run")
+
+	// result cache flags
+	var cacheFile string
+	flag.StringVar(&cacheFile, "cache", "", "file of recent results to reuse instead of probing the same URLs again")
+
+	cacheTTL := durationArg(time.Hour)
+	flag.Var(&cacheTTL, "cache-ttl", "how long results in the -cache file are reused for")
+
+	var noCache bool
+	flag.BoolVar(&noCache, "no-cache", false, "probe everything again but still update the -cache file")
+
+	// output separator flag
+	var sep string
+	flag.StringVar(&sep, "sep", " ", "separator between the URL and its annotations (\\t for a tab)")
+
+	// diff flag
+	var diffFile string
+	flag.StringVar(&diffFile, "diff", "", "compare with the output of a previous run, marking new URLs with + and gone URLs with -")
+
+	// flush flag
+	var flush bool
+	flag.BoolVar(&flush, "flush", false, "flush output after every line even when stdout isn't a terminal")
+
+	// timestamp flag
+	var timestamp bool
+	flag.BoolVar(&timestamp, "timestamp", false, "prefix each result with an ISO-8601 timestamp")
+
+	// output file flag
+	var outputFile string
+	flag.StringVar(&outputFile, "o", "", "also write results to this file")
+
+	// webhook flag
+	var webhook string
+	flag.StringVar(&webhook, "webhook", "", "also POST each result as JSON to this URL")
+
+	// append file flags
+	var appendFile string
+	flag.StringVar(&appendFile, "append-file", "", "append live results to this file as JSON lines")
+
+	// url append flag
+	var appendURLs string
+	flag.StringVar(&appendURLs, "append-urls", "", "append the URL of each live result to this file as soon as it's found")
+
+	// split output flag
+	var splitDir string
+	flag.StringVar(&splitDir, "split-dir", "", "also write results to 2xx.txt, 3xx.txt, 4xx.txt and 5xx.txt in this directory")
+
+	var rotateSize int
+	flag.IntVar(&rotateSize, "rotate-size", 0, "rotate the -append-file once it grows beyond this many megabytes")
+
+	// stats flag
+	var showStats bool
+	flag.BoolVar(&showStats, "stats", false, "print a summary of the scan to stderr at the end")
+
+	// progress flag
+	var progress bool
+	flag.BoolVar(&progress, "progress", false, "write a machine-readable progress line to stderr every second")
+
+	// body matchers flag
+	var matchersFile string
+	flag.StringVar(&matchersFile, "matchers-file", "", "file of (optionally labelled) regexes; results are annotated with the labels that match the body")
+
+	// tech detection flag
+	var tech bool
+	flag.BoolVar(&tech, "tech", false, "annotate results with the technologies detected from a small built-in set of signatures")
+
+	// user agent comparison flags
+	var compareUAs bool
+	flag.BoolVar(&compareUAs, "compare-ua", false, "probe live URLs again with a bot User-Agent and annotate those whose status or body length differ")
+
+	var botUA string
+	flag.StringVar(&botUA, "bot-ua", defaultBotUA, "User-Agent to compare against with -compare-ua")
+
+	// exec matcher flags
+	var matchExec string
+	flag.StringVar(&matchExec, "match-exec", "", "only output URLs for which this shell command exits 0 ($1 is the URL, $2 the status, the body is on stdin)")
+
+	var matchExecC int
+	flag.IntVar(&matchExecC, "match-exec-c", 10, "maximum number of -match-exec commands to run at once")
+
+	// drain flag
+	var noDrain bool
+	flag.BoolVar(&noDrain, "no-drain", false, "don't read response bodies unless an option needs them")
+
+	// count flag
+	var countOnly bool
+	flag.BoolVar(&countOnly, "count", false, "don't output URLs, just print the total, alive and dead counts at the end")
+
+	// sort flag
+	var sortOutput bool
+	flag.BoolVar(&sortOutput, "sort", false, "buffer results and output them sorted by status code then URL at the end")
+
+	// include input flag
+	var includeInput bool
+	flag.BoolVar(&includeInput, "include-input", false, "prefix each result with the input line it was generated from and a tab")
+
+	// show probe flag
+	var showProbe bool
+	flag.BoolVar(&showProbe, "show-probe", false, "annotate each result with the probe that generated it (e.g. [xlarge:8080])")
+
+	// default port flag
+	var dropDefaultPorts bool
+	flag.BoolVar(&dropDefaultPorts, "drop-default-ports", false, "remove :80 from http and :443 from https URLs in the output")
+
+	// canonicalize flag
+	var canonicalize bool
+	flag.BoolVar(&canonicalize, "canonicalize", false, "output URLs in a canonical form (lowercase host, no default ports or trailing dots, sorted query)")
+
+	// metrics flag
+	var metricsAddr string
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address (e.g. :9090)")
+
+	// benchmark flags
+	var benchURL string
+	flag.StringVar(&benchURL, "bench", "", "repeatedly probe this URL and report latency percentiles instead of reading stdin")
+
+	var benchCount int
+	flag.IntVar(&benchCount, "n", 100, "number of requests to make with -bench")
+
 	flag.Parse()
 
-	timeout := time.Duration(to) * time.Millisecond
+	if listTemplates {
+		printTemplates(os.Stdout)
+		return exitAlive
+	}
+
+	probes = checkProbes(probes)
+
+	// these keep the first result for each host, IP or title, which
+	// could then fail confirmation and leave nothing in its place
+	if confirm > 0 && (firstOnly || uniqueIP || distinctTitle) {
+		fmt.Fprintln(os.Stderr, "-confirm can't be used with -first-only, -unique-ip or -distinct-title")
+		return exitError
+	}
+
+	if buffer < 0 {
+		fmt.Fprintln(os.Stderr, "-buffer can't be negative")
+		return exitError
+	}
+
+	schemes, err := parseSchemes(schemeArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-scheme: %s\n", err)
+		return exitError
+	}
+
+	portSchemes, err := parsePortSchemes(portSchemeMap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if only != "" && !validScheme(only) {
+		fmt.Fprintf(os.Stderr, "-only: invalid scheme %q\n", only)
+		return exitError
+	}
+
+	gen := &generator{
+		skipDefault: skipDefault,
+		probes:      probes,
+		schemes:     schemes,
+		portSchemes: portSchemes,
+		only:        only,
+		trimPath:    trimPath,
+	}
+
+	if timeoutMult <= 0 {
+		fmt.Fprintln(os.Stderr, "-timeout-multiplier must be greater than 0")
+		return exitError
+	}
+	scale := func(d durationArg) time.Duration {
+		return time.Duration(float64(d) * timeoutMult)
+	}
+
+	timeout := scale(to)
+	dialTimeout := timeout
+	if dialTo > 0 {
+		dialTimeout = scale(dialTo)
+	}
+	expectContinueTimeout := scale(expectContinueTo)
+	certWindow := time.Duration(certExpiry) * 24 * time.Hour
+	slowThreshold := time.Duration(slow) * time.Millisecond
+	fastThreshold := time.Duration(fast) * time.Millisecond
+	sep = strings.Replace(sep, `\t`, "\t", -1)
+
+	opts := &probeOptions{
+		method:         method,
+		keepBody:       matchString != "" || distinctTitle || matchersFile != "" || wildcard || matchExec != "" || tech || dropParked,
+		timeoutRetries: timeoutRetries,
+		connRetries:    connRetries,
+		websocket:      websocket,
+		referer:        referer,
+		autoReferer:    autoReferer,
+		backoff: backoff{
+			strategy: backoffStrategy,
+			base:     time.Duration(backoffDelay) * time.Millisecond,
+			max:      time.Duration(backoffMax) * time.Millisecond,
+		},
+	}
+
+	if !validBackoff(backoffStrategy) {
+		fmt.Fprintln(os.Stderr, "-backoff must be constant, linear or exponential")
+		return exitError
+	}
+
+	// connections are never reused so it's safe to close the body
+	// without reading it when nothing needs the body or its length
+	opts.noDrain = noDrain && !opts.keepBody && clusterCL == 0 && !sizeHist && !compareUAs
+
+	if data != "" {
+		body, err := readData(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read request body: %s\n", err)
+			return exitError
+		}
+		opts.data = body
+		if opts.method == "" {
+			opts.method = "POST"
+		}
+	}
+	if opts.method == "" {
+		opts.method = "GET"
+	}
+
+	portMethods, err := parsePortMethods(hostMethodMap)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+	opts.portMethods = portMethods
+
+	if expectContinue && opts.data == nil {
+		fmt.Fprintln(os.Stderr, "-expect-continue requires -data")
+		return exitError
+	}
+	opts.expectContinue = expectContinue
+
+	if headBodyCheck && !strings.EqualFold(opts.method, "HEAD") {
+		fmt.Fprintln(os.Stderr, "-head-body-check requires -m HEAD")
+		return exitError
+	}
+
+	methods, err := parseMethods(methodList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-methods: %s\n", err)
+		return exitError
+	}
+
+	hs, err := headers.parse()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+	if profile != "" {
+		ph, err := loadProfile(profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load profile: %s\n", err)
+			return exitError
+		}
+		for name, vals := range hs {
+			ph[name] = vals
+		}
+		hs = ph
+	}
+	opts.headers = hs
+
+	if useNetrc {
+		n, err := loadNetrc(netrcPath())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read netrc file: %s\n", err)
+			return exitError
+		}
+		opts.netrc = n
+	}
+
+	var bodyMatchers []bodyMatcher
+	if matchersFile != "" {
+		bodyMatchers, err = loadBodyMatchers(matchersFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load matchers: %s\n", err)
+			return exitError
+		}
+	}
+
+	headerMatchers := parseHeaderMatchers(hasHeaders, headerInsensitive)
 
 	var tr = &http.Transport{
 		MaxIdleConns:        1000,
 		MaxIdleConnsPerHost: 500,
 		MaxConnsPerHost:     500,
 		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		DialContext:         (&net.Dialer{Timeout: dialTimeout}).DialContext,
+
+		// only used for requests with an Expect: 100-continue header
+		ExpectContinueTimeout: expectContinueTimeout,
+	}
+
+	lookupHost := net.DefaultResolver.LookupHost
+	if dnsTTL > 0 {
+		cache := newDNSCache(time.Duration(dnsTTL))
+		tr.DialContext = cache.dialContext(&net.Dialer{Timeout: dialTimeout})
+		lookupHost = cache.lookup
+	}
+
+	var sf *scopeFilter
+	if scope != "" {
+		sf, err = newScopeFilter(scope, dialTimeout, lookupHost)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-scope: %s\n", err)
+			return exitError
+		}
+	}
+
+	if ipv4Only && ipv6Only {
+		fmt.Fprintln(os.Stderr, "-4 and -6 can't be used together")
+		return exitError
+	}
+	// QUIC connections for -http3 are restricted to the same family
+	udpNetwork := "udp"
+	if ipv4Only || ipv6Only {
+		family := "tcp4"
+		udpNetwork = "udp4"
+		if ipv6Only {
+			family, udpNetwork = "tcp6", "udp6"
+		}
+		dial := tr.DialContext
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, family, addr)
+		}
+	}
+	// the probes that don't go through the transport share its dialer
+	dial := dialFunc(tr.DialContext)
+
+	if tlsReport {
+		enableWeakTLS(tr.TLSClientConfig)
+	}
+
+	// QUIC needs TLS 1.3, which -ciphers turns off
+	if useHTTP3 && ciphers != "" {
+		fmt.Fprintln(os.Stderr, "-http3 can't be used with -ciphers")
+		return exitError
+	}
+	if ciphers != "" {
+		ids, err := parseCiphers(ciphers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-ciphers: %s\n", err)
+			return exitError
+		}
+		restrictCiphers(tr.TLSClientConfig, ids)
+	}
+
+	// every probe uses the same server name, so it can be set on
+	// the shared config; certificates aren't verified so there's
+	// no need for it to match the host being connected to
+	if sni != "" {
+		tr.TLSClientConfig.ServerName = sni
+	}
+
+	if noHTTP1 && !alpnH2 {
+		fmt.Fprintln(os.Stderr, "-no-http1 requires -h2")
+		return exitError
+	}
+	if alpnH2 {
+		protos := new(http.Protocols)
+		protos.SetHTTP1(!noHTTP1)
+		protos.SetHTTP2(true)
+		tr.Protocols = protos
 	}
 
+	grpcs, err := parseGRPCPorts(grpcPortList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	// gRPC needs HTTP/2, using h2c for plain http URLs
+	grpcTr := tr.Clone()
+	grpcTr.Protocols = new(http.Protocols)
+	grpcTr.Protocols.SetHTTP2(true)
+	grpcTr.Protocols.SetUnencryptedHTTP2(true)
+	grpcClient := &http.Client{Transport: grpcTr, Timeout: timeout}
+
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
 		Transport:     tr,
@@ -76,10 +812,252 @@ func main() {
 		client.CheckRedirect = nil
 	}
 
+	var h3Client *http.Client
+	if useHTTP3 {
+		h3Client = newHTTP3Client(tr.TLSClientConfig, lookupHost, udpNetwork, dialTimeout, timeout, client.CheckRedirect)
+	}
+
+	if matchInsensitive {
+		matchString = strings.ToLower(matchString)
+	}
+
+	// a sample over 1 is taken to be a percentage
+	if sample > 1 {
+		sample = sample / 100
+	}
+	if sample <= 0 || sample > 1 {
+		fmt.Fprintln(os.Stderr, "-sample must be between 0 and 1, or a percentage")
+		return exitError
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	if uaFile != "" {
+		randHeaders = append(randHeaders, "User-Agent="+uaFile)
+	}
+	if len(randHeaders) > 0 {
+		pool := newHeaderPool(seed)
+		for _, arg := range randHeaders {
+			name, path, err := parseRandomHeader(arg)
+			if err == nil {
+				err = pool.load(name, path)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load random header values: %s\n", err)
+				return exitError
+			}
+		}
+		opts.randomHeaders = pool
+	}
+
+	if benchURL != "" {
+		if benchCount < 1 {
+			fmt.Fprintln(os.Stderr, "-n must be at least 1")
+			return exitError
+		}
+		br := runBench(client, benchURL, opts, benchCount, concurrency)
+		br.print(os.Stdout)
+		if len(br.latencies) == 0 {
+			return exitNoneAlive
+		}
+		return exitAlive
+	}
+
+	var subs []string
+	if subFile != "" {
+		subs, err = readLines(subFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read subdomain file: %s\n", err)
+			return exitError
+		}
+	}
+
+	var wf *wildcardFilter
+	if wildcard {
+		wf = newWildcardFilter(client, opts)
+	}
+
+	var rc *robotsCache
+	if robots {
+		rc = newRobotsCache(client)
+	}
+
+	var previous map[string]bool
+	if diffFile != "" {
+		previous, err = loadPrevious(diffFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read previous results: %s\n", err)
+			return exitError
+		}
+	}
+	current := newSeenSet()
+
+	var cp *checkpoint
+	if resume != "" {
+		cp, err = openCheckpoint(resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open checkpoint file: %s\n", err)
+			return exitError
+		}
+		defer cp.Close()
+	}
+
+	var ht *hostTimer
+	if maxHostTime > 0 {
+		ht = newHostTimer(time.Duration(maxHostTime) * time.Millisecond)
+	}
+
+	var throttle *hostThrottle
+	if throttle429 {
+		throttle = newHostThrottle()
+	}
+
+	var refused *refusedHosts
+	if n := gen.defaultProbes(); failFast && n > 0 {
+		refused = newRefusedHosts(n)
+	}
+
+	var rcache *resultCache
+	if cacheFile != "" {
+		rcache, err = openResultCache(cacheFile, time.Duration(cacheTTL), !noCache, cacheOptions(flag.CommandLine))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read cache file: %s\n", err)
+			return exitError
+		}
+	}
+
+	var em *execMatcher
+	if matchExec != "" {
+		if matchExecC < 1 {
+			fmt.Fprintln(os.Stderr, "-match-exec-c must be at least 1")
+			return exitError
+		}
+		em = newExecMatcher(matchExec, matchExecC, timeout)
+	}
+
+	clusters := newLengthClusters()
+	sizes := &sizeHistogram{}
+	titles := newSeenSet()
+	doneHosts := newSeenSet()
+	seenIPs := newSeenSet()
+
+	stats := &counters{}
+	if metricsAddr != "" {
+		srv := serveMetrics(metricsAddr, stats)
+		defer srv.Close()
+	}
+
+	var stopProgress func()
+	if progress {
+		stopProgress = stats.reportProgress(os.Stderr, time.Second)
+	}
+
 	// we send urls to check on the urls channel,
 	// but only get them on the output channel if
 	// they are accepting connections
-	urls := make(chan string)
+	urls := make(chan target, buffer)
+
+	// output is flushed per line when someone is watching it
+	out := newLineWriter(os.Stdout, flush || follow || isTerminal(os.Stdout))
+
+	// results go to stdout and any other configured sinks; outputs
+	// are just the ones that -diff's gone URLs are written to too
+	var sinks, outputs multiSink
+	if randomize && follow {
+		fmt.Fprintln(os.Stderr, "-randomize-input can't be used with -follow")
+		return exitError
+	}
+
+	if sortOutput && (follow || flush) {
+		fmt.Fprintln(os.Stderr, "-sort can't be used with -follow or -flush")
+		return exitError
+	}
+
+	if !countOnly {
+		var s Sink = &textSink{out: out}
+		if sortOutput {
+			s = &sortedSink{next: s}
+		}
+		sinks = append(sinks, s)
+		outputs = append(outputs, s)
+	}
+	if outputFile != "" {
+		fs, err := newFileSink(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create output file: %s\n", err)
+			return exitError
+		}
+		var s Sink = fs
+		if sortOutput {
+			s = &sortedSink{next: s}
+		}
+		sinks = append(sinks, s)
+		outputs = append(outputs, s)
+	}
+	if splitDir != "" {
+		ss, err := newSplitSink(splitDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create split directory: %s\n", err)
+			return exitError
+		}
+		var s Sink = ss
+		if sortOutput {
+			s = &sortedSink{next: s}
+		}
+		sinks = append(sinks, s)
+		outputs = append(outputs, s)
+	}
+	if appendFile != "" {
+		af, err := openRotatingFile(appendFile, int64(rotateSize)*1024*1024)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open append file: %s\n", err)
+			return exitError
+		}
+		sinks = append(sinks, &jsonLinesSink{af})
+	}
+	if appendURLs != "" {
+		us, err := newURLSink(appendURLs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open URL file: %s\n", err)
+			return exitError
+		}
+		sinks = append(sinks, us)
+	}
+	if webhook != "" {
+		sinks = append(sinks, newWebhookSink(webhook, timeout))
+	}
+
+	// consecutive failures across all workers; reset on any success.
+	// Once there are too many, aborted is set and the remaining URLs
+	// are drained without being probed.
+	var consecutiveErrors int64
+	var aborted int32
+
+	// found counts the URLs that were output, and ioFailed is set
+	// when writing results fails, for the exit code
+	var found int64
+	var ioFailed int32
+
+	send := func(r *result) {
+		atomic.AddInt64(&found, 1)
+		if err := sinks.Emit(r); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to output result: %s\n", err)
+			atomic.StoreInt32(&ioFailed, 1)
+		}
+	}
+
+	// with -confirm results are held back for a second pass
+	pending := &pendingResults{}
+	emit := func(r *result) {
+		if confirm > 0 {
+			pending.add(r)
+			return
+		}
+		send(r)
+	}
 
 	// Spin up a bunch of workers
 	var wg sync.WaitGroup
@@ -87,66 +1065,537 @@ func main() {
 		wg.Add(1)
 
 		go func() {
-			for url := range urls {
-				if isListening(client, url, redirectEndpoint) {
-					fmt.Println(url)
+			client := client
+			if isolate {
+				client = &http.Client{
+					CheckRedirect: client.CheckRedirect,
+					Transport:     tr.Clone(),
+					Timeout:       timeout,
+				}
+			}
+
+			// deliver does the bookkeeping for a live result that has
+			// passed the filters, whether it was just probed or came
+			// from the cache, and outputs it
+			deliver := func(t target, shown string, e cacheEntry) {
+				if clusterCL > 0 {
+					clusters.add(t.url, e.Length)
+				}
+				if sizeHist {
+					sizes.add(e.Length)
+				}
+
+				if firstOnly && !doneHosts.first(hostname(t.url)) {
+					return
+				}
+
+				if uniqueIP && e.IP != "" && !seenIPs.first(e.IP) {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "skipped (duplicate IP %s): %s\n", e.IP, t.url)
+					}
+					return
+				}
+
+				line := e.Line
+				jr := *e.Result
+				if includeInput {
+					line = t.input + "\t" + line
+					jr.Input = t.input
+				}
+				if timestamp {
+					emitted := time.Now().Format(time.RFC3339)
+					line = emitted + sep + line
+					jr.Timestamp = emitted
+				}
+
+				// the marker goes before any prefixes so that new
+				// URLs stand out
+				if previous != nil {
+					current.first(shown)
+					if !previous[shown] {
+						line = "+" + line
+					}
+				}
+				emit(&result{url: t.url, line: line, json: jr})
+			}
+
+			for t := range urls {
+				if atomic.LoadInt32(&aborted) != 0 {
+					continue
+				}
+				url := t.url
+
+				// shown is the URL as it's output
+				shown := url
+				if canonicalize {
+					shown = canonicalURL(url)
+				} else if dropDefaultPorts {
+					shown = stripDefaultPort(url)
+				}
+				if cp.done(url) {
+					continue
+				}
+
+				if firstOnly && doneHosts.has(hostname(url)) {
 					continue
 				}
 
-				if verbose {
-					fmt.Fprintf(os.Stderr, "failed: %s\n", url)
+				if t.probe != "default" && refused.dead(hostname(url)) {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "skipped (refused): %s\n", url)
+					}
+					continue
+				}
+
+				if addr := sf.check(hostname(asciiURL(url))); addr != "" {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "skipped (out of scope: %s): %s\n", addr, url)
+					}
+					continue
 				}
+
+				if ht.exceeded(hostname(url)) {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "skipped (host time limit): %s\n", url)
+					}
+					continue
+				}
+
+				if rc != nil && !rc.allowed(url) {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "skipped (robots.txt): %s\n", url)
+					}
+					continue
+				}
+
+				if connectMode {
+					stats.start()
+					err := acceptsConnect(dial, url, connectTarget, timeout)
+					stats.finish(err == nil)
+					cp.record(url)
+					if err != nil {
+						if verbose {
+							fmt.Fprintf(os.Stderr, "failed: %s (%s)\n", url, errorCategory(err))
+						}
+						continue
+					}
+					jr := jsonResult{URL: shown}
+					line := shown
+					if includeInput {
+						line = t.input + "\t" + line
+						jr.Input = t.input
+					}
+					emit(&result{url: url, line: line, json: jr})
+					continue
+				}
+
+				if tcpOnly {
+					stats.start()
+					remote, err := tcpConnect(dial, url, tr.TLSClientConfig, dialTimeout)
+					stats.finish(err == nil)
+					cp.record(url)
+					if err != nil {
+						if verbose {
+							fmt.Fprintf(os.Stderr, "failed: %s (%s)\n", url, errorCategory(err))
+						}
+						continue
+					}
+					jr := jsonResult{URL: shown}
+					line := shown
+					if ipv4Only || ipv6Only {
+						line += sep + "[" + addrFamily(remote) + "]"
+					}
+					if includeInput {
+						line = t.input + "\t" + line
+						jr.Input = t.input
+					}
+					emit(&result{url: url, line: line, json: jr})
+					continue
+				}
+
+				if tlsProbe {
+					// there's nothing to handshake with on plain http
+					if strings.HasPrefix(url, "http://") {
+						continue
+					}
+					stats.start()
+					state, err := tlsHandshake(dial, url, tr.TLSClientConfig, timeout)
+					stats.finish(err == nil)
+					cp.record(url)
+					if err != nil {
+						if verbose {
+							fmt.Fprintf(os.Stderr, "failed: %s (%s)\n", url, errorCategory(err))
+						}
+						continue
+					}
+					line := shown + sep + tlsInfoNote(state)
+					if certExpiry > 0 {
+						if note := certExpiryNote(state, certWindow); note != "" {
+							line += sep + note
+						}
+					}
+					if tlsReport {
+						if note := weakTLSNote(state); note != "" {
+							line += sep + note
+						}
+					}
+					emit(&result{url: url, line: line, json: jsonResult{URL: shown}})
+					continue
+				}
+
+				if grpcs.match(url) {
+					stats.start()
+					status, err := grpcHealthCheck(grpcClient, url)
+					stats.finish(err == nil)
+					cp.record(url)
+					if err == nil && status != "SERVING" {
+						err = fmt.Errorf("grpc: %s", status)
+					}
+					if err != nil {
+						if verbose {
+							fmt.Fprintf(os.Stderr, "failed: %s (%s)\n", url, err)
+						}
+						continue
+					}
+					emit(&result{url: url, line: shown + sep + "[grpc: " + status + "]", json: jsonResult{URL: shown}})
+					continue
+				}
+
+				// cache hits are counted like probes, but the filters
+				// they passed when they were cached aren't run again
+				if e, ok := rcache.get(url); ok {
+					stats.start()
+					alive := e.Alive && e.Result != nil
+					stats.finish(alive && !e.Hang)
+					cp.record(url)
+					if !alive {
+						if verbose {
+							fmt.Fprintf(os.Stderr, "failed: %s (cached)\n", url)
+						}
+						continue
+					}
+					if !e.Hang {
+						stats.addBytes(e.Length)
+						stats.addStatus(e.Result.StatusCode)
+					}
+
+					if distinctTitle && e.Title != "" && !titles.first(e.Title) {
+						continue
+					}
+					deliver(t, shown, e)
+					continue
+				}
+
+				stats.start()
+				throttle.wait(hostname(url))
+				started := time.Now()
+				res, err := probeURL(client, h3Client, url, opts, verbose)
+				ht.add(hostname(url), time.Since(started))
+				stats.finish(err == nil)
+				cp.record(url)
+				if err != nil {
+					if t.probe == "default" && errorCategory(err) == "connection refused" {
+						refused.add(hostname(url))
+					}
+
+					var hang hangError
+					if hangDetect && errors.As(err, &hang) {
+						e := cacheEntry{
+							Alive:  true,
+							Hang:   true,
+							Line:   shown + sep + "[hang]",
+							Result: &jsonResult{URL: shown},
+						}
+						rcache.put(url, e)
+						deliver(t, shown, e)
+					} else {
+						rcache.put(url, cacheEntry{})
+						if verbose {
+							fmt.Fprintf(os.Stderr, "failed: %s (%s)\n", url, errorCategory(err))
+						}
+					}
+					if maxErrors > 0 && atomic.AddInt64(&consecutiveErrors, 1) == int64(maxErrors)+1 {
+						fmt.Fprintf(os.Stderr, "aborting: more than %d consecutive probes failed\n", maxErrors)
+						atomic.StoreInt32(&aborted, 1)
+					}
+					continue
+				}
+				atomic.StoreInt64(&consecutiveErrors, 0)
+				throttle.observe(hostname(url), res.resp)
+
+				if redirectEndpoint && !countOnly {
+					out.println("redirect - " + res.resp.Request.URL.String())
+				}
+				stats.addBytes(res.length)
+				stats.addStatus(res.resp.StatusCode)
+
+				if websocket && res.resp.StatusCode != http.StatusSwitchingProtocols {
+					continue
+				}
+
+				if matchString != "" && !bodyContains(res.body, matchString, matchInsensitive) {
+					continue
+				}
+
+				if wf != nil && wf.matches(res) {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "skipped (wildcard): %s\n", url)
+					}
+					continue
+				}
+
+				if dropParked {
+					if parked, why := isParked(res); parked {
+						if verbose {
+							fmt.Fprintf(os.Stderr, "skipped (parked, %s): %s\n", why, url)
+						}
+						continue
+					}
+				}
+
+				if onlyRedirects && !redirected(res.resp) {
+					continue
+				}
+
+				if !matchAllHeaders(headerMatchers, res.resp.Header) {
+					continue
+				}
+
+				var title string
+				if distinctTitle {
+					title = extractTitle(res.body, res.resp.Header.Get("Content-Type"))
+					if title != "" && !titles.first(title) {
+						continue
+					}
+				}
+
+				if slow > 0 && res.ttfb <= slowThreshold {
+					continue
+				}
+
+				if em != nil && !em.match(res) {
+					continue
+				}
+
+				// with -slow both ends of the band use the time to first byte
+				if fast > 0 {
+					rt := res.elapsed
+					if slow > 0 {
+						rt = res.ttfb
+					}
+					if rt >= fastThreshold {
+						continue
+					}
+				}
+
+				var notes []string
+				if showProbe {
+					notes = append(notes, "["+t.probe+"]")
+				}
+				if responseTime {
+					// with -slow it's the time to first byte that matters
+					rt := res.elapsed
+					if slow > 0 {
+						rt = res.ttfb
+					}
+					notes = append(notes, fmt.Sprintf("[%dms]", rt.Milliseconds()))
+				}
+				if alpnH2 || useHTTP3 {
+					notes = append(notes, "["+res.resp.Proto+"]")
+				}
+				if certExpiry > 0 {
+					if note := certExpiryNote(res.resp.TLS, certWindow); note != "" {
+						notes = append(notes, note)
+					}
+				}
+
+				if labels := matchBody(bodyMatchers, res.body); len(labels) > 0 {
+					notes = append(notes, "[match: "+strings.Join(labels, ", ")+"]")
+				}
+
+				if tech {
+					if note := detectTech(res.resp, res.body); note != "" {
+						notes = append(notes, note)
+					}
+				}
+
+				if tlsReport {
+					if note := weakTLSNote(res.resp.TLS); note != "" {
+						notes = append(notes, note)
+					}
+				}
+
+				if (ipv4Only || ipv6Only) && res.remoteAddr != "" {
+					notes = append(notes, "["+addrFamily(res.remoteAddr)+"]")
+				}
+
+				if sni != "" && res.resp.TLS != nil {
+					notes = append(notes, "[sni: "+sni+"]")
+				}
+
+				if expectContinue && res.continued {
+					notes = append(notes, "[100-continue]")
+				}
+
+				if ja3sPrint && res.resp.TLS != nil {
+					if fp, err := ja3s(dial, url, tr.TLSClientConfig, timeout); err == nil {
+						notes = append(notes, "[ja3s: "+fp+"]")
+					}
+				}
+
+				if headBodyCheck {
+					if n, err := headBodySize(dial, url, tr.TLSClientConfig, timeout); err == nil && n > 0 {
+						notes = append(notes, fmt.Sprintf("[HEAD body: %d bytes]", n))
+					}
+				}
+
+				if len(methods) > 0 {
+					notes = append(notes, methodSummary(client, url, opts, methods))
+				}
+
+				if compareUAs {
+					if note := compareUA(client, url, opts, res, botUA); note != "" {
+						notes = append(notes, note)
+					}
+				}
+
+				jr := newJSONResult(res)
+				jr.URL = shown
+				e := cacheEntry{
+					Alive:  true,
+					Line:   strings.Join(append([]string{shown}, notes...), sep),
+					Result: &jr,
+					Length: res.length,
+					Title:  title,
+				}
+				if res.remoteAddr != "" {
+					e.IP, _, _ = net.SplitHostPort(res.remoteAddr)
+				}
+				rcache.put(url, e)
+				deliver(t, shown, e)
 			}
 
 			wg.Done()
 		}()
 	}
 
-	// accept domains on stdin
-	sc := bufio.NewScanner(os.Stdin)
+	// with -randomize-input generated URLs are collected so they
+	// can be shuffled before being sent to the workers
+	queue := urls
+	var collected []target
+	collectDone := make(chan struct{})
+	if randomize {
+		queue = make(chan target)
+		go func() {
+			for t := range queue {
+				collected = append(collected, t)
+			}
+			close(collectDone)
+		}()
+	}
+
+	// accept domains on stdin, or URLs from the replay file
+	var in io.Reader = os.Stdin
+	if replayFile != "" {
+		f, err := os.Open(replayFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open replay file: %s\n", err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+	}
+	if follow {
+		in = &followReader{
+			r:        in,
+			interval: 500 * time.Millisecond,
+			stop:     func() bool { return atomic.LoadInt32(&aborted) != 0 },
+		}
+	}
+	sc := bufio.NewScanner(in)
 	for sc.Scan() {
-		domain := strings.TrimSpace(strings.ToLower(sc.Text()))
+		if atomic.LoadInt32(&aborted) != 0 {
+			break
+		}
+
+		input := strings.TrimSpace(sc.Text())
+		domain := input
+		if !noLower {
+			domain = strings.ToLower(domain)
+		}
 
 		if domain == "" {
 			continue
 		}
 
-		// submit http and https versions to be checked
-		if !skipDefault {
-			urls <- "http://" + domain
-			urls <- "https://" + domain
+		if csvInput && csvHeader {
+			csvHeader = false
+			continue
 		}
 
-		// Adding port templates
-		xlarge := []string{"81", "300", "591", "593", "832", "981", "1010", "1311", "2082", "2087", "2095", "2096", "2480", "3000", "3128", "3333", "4243", "4567", "4711", "4712", "4993", "5000", "5104", "5108", "5800", "6543", "7000", "7396", "7474", "8000", "8001", "8008", "8014", "8042", "8069", "8080", "8081", "8088", "8090", "8091", "8118", "8123", "8172", "8222", "8243", "8280", "8281", "8333", "8443", "8500", "8834", "8880", "8888", "8983", "9000", "9043", "9060", "9080", "9090", "9091", "9200", "9443", "9800", "9981", "12443", "16080", "18091", "18092", "20720", "28017"}
-		large := []string{"81", "591", "2082", "2087", "2095", "2096", "3000", "8000", "8001", "8008", "8080", "8083", "8443", "8834", "8888"}
+		if sample < 1 && rng.Float64() >= sample {
+			continue
+		}
 
-		// submit any additional proto:port probes
-		for _, p := range probes {
-			switch p {
-			case "xlarge":
-				for _, port := range xlarge {
-					urls <- fmt.Sprintf("http://%s:%s", domain, port)
-					urls <- fmt.Sprintf("https://%s:%s", domain, port)
-				}
-			case "large":
-				for _, port := range large {
-					urls <- fmt.Sprintf("http://%s:%s", domain, port)
-					urls <- fmt.Sprintf("https://%s:%s", domain, port)
-				}
-			default:
-				pair := strings.SplitN(p, ":", 2)
-				if len(pair) != 2 {
-					continue
-				}
-				urls <- fmt.Sprintf("%s://%s:%s", pair[0], domain, pair[1])
+		if csvInput {
+			u, err := csvURL(input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipping row %q: %s\n", input, err)
+				continue
 			}
+			queue <- target{url: u, input: input, probe: "csv"}
+			continue
+		}
+
+		// replayed URLs are probed as they are, without templating
+		if replayFile != "" {
+			if u, ok := replayURL(input); ok {
+				queue <- target{url: u, input: input, probe: "replay"}
+			} else if verbose {
+				fmt.Fprintf(os.Stderr, "skipped (not a URL): %s\n", input)
+			}
+			continue
+		}
+
+		if nmapInput {
+			for _, u := range grepableURLs(sc.Text()) {
+				queue <- target{url: u, input: input, probe: "nmap"}
+			}
+			continue
+		}
+
+		gen.submit(queue, input, domain)
+		if www {
+			if v := wwwVariant(domain); v != "" {
+				gen.submit(queue, input, v)
+			}
+		}
+		for _, sub := range subs {
+			if !noLower {
+				sub = strings.ToLower(sub)
+			}
+			gen.submit(queue, input, sub+"."+domain)
 		}
 	}
 
 	// check there were no errors reading stdin (unlikely)
-	if err := sc.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to read input: %s\n", err)
+	inputErr := sc.Err()
+	if inputErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to read input: %s\n", inputErr)
+	}
+
+	if randomize {
+		close(queue)
+		<-collectDone
+		rng.Shuffle(len(collected), func(i, j int) {
+			collected[i], collected[j] = collected[j], collected[i]
+		})
+		for _, t := range collected {
+			if atomic.LoadInt32(&aborted) != 0 {
+				break
+			}
+			urls <- t
+		}
 	}
 
 	// once we've sent all the URLs off we can close the
@@ -155,31 +1604,103 @@ func main() {
 	close(urls)
 	// Wait until all the workers have finished
 	wg.Wait()
-}
 
-func isListening(client *http.Client, url string, redirectEndpoint bool) bool {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return false
+	if confirm > 0 {
+		alive := func(url string) bool {
+			var err error
+			switch {
+			case connectMode:
+				err = acceptsConnect(dial, url, connectTarget, timeout)
+			case tlsProbe:
+				_, err = tlsHandshake(dial, url, tr.TLSClientConfig, timeout)
+			case tcpOnly:
+				_, err = tcpConnect(dial, url, tr.TLSClientConfig, dialTimeout)
+			default:
+				_, err = probeURL(client, h3Client, url, opts, false)
+				var hang hangError
+				if hangDetect && errors.As(err, &hang) {
+					err = nil
+				}
+			}
+			return err == nil
+		}
+		for _, r := range pending.confirm(confirm, concurrency, alive, verbose) {
+			send(r)
+		}
 	}
 
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_4) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/73.0.3683.103 Safari/537.36")
-	req.Header.Add("Accept", "*/*")
-	req.Header.Add("Accept-Language", "en-US,en;q=0.8")
-	req.Header.Add("Connection", "close")
-	req.Close = true
+	if stopProgress != nil {
+		stopProgress()
+	}
 
-	resp, err := client.Do(req)
-	if resp != nil {
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
+	if previous != nil {
+		for _, r := range goneResults(previous, current) {
+			if err := outputs.Emit(r); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to output result: %s\n", err)
+				atomic.StoreInt32(&ioFailed, 1)
+			}
+		}
 	}
-	if err != nil {
-		return false
+
+	if countOnly {
+		out.println(fmt.Sprintf("total: %d, alive: %d, dead: %d",
+			atomic.LoadInt64(&stats.total),
+			atomic.LoadInt64(&found),
+			atomic.LoadInt64(&stats.dead),
+		))
+
+		// stdout isn't one of the sinks with -count, but
+		// still needs flushing along with them
+		sinks = append(sinks, &textSink{out: out})
+	}
+
+	if err := rcache.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save cache file: %s\n", err)
+		atomic.StoreInt32(&ioFailed, 1)
 	}
-	if redirectEndpoint {
-		fmt.Printf("redirect - %s\n", resp.Request.URL)
+
+	if err := sinks.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write output: %s\n", err)
+		atomic.StoreInt32(&ioFailed, 1)
+	}
+
+	if clusterCL > 0 {
+		clusters.print(os.Stderr, clusterCL)
 	}
 
-	return true
+	if sizeHist {
+		sizes.print(os.Stderr)
+	}
+
+	if showStats {
+		stats.summary(os.Stderr)
+	}
+
+	switch {
+	case inputErr != nil, atomic.LoadInt32(&ioFailed) != 0, atomic.LoadInt32(&aborted) != 0:
+		return exitError
+	case atomic.LoadInt64(&found) == 0:
+		return exitNoneAlive
+	}
+	return exitAlive
+}
+
+// readLines returns the non-empty, trimmed lines of the file at path
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
 }
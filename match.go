@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// headerMatcher matches responses that include a header, and
+// optionally require it to have a particular value
+type headerMatcher struct {
+	name        string
+	value       string
+	insensitive bool
+}
+
+// parseHeaderMatchers parses -has-header arguments in the form name
+// or name=value. When insensitive is set values are compared without
+// regard to case.
+func parseHeaderMatchers(args []string, insensitive bool) []headerMatcher {
+	var out []headerMatcher
+	for _, arg := range args {
+		pair := strings.SplitN(arg, "=", 2)
+		m := headerMatcher{
+			name:        http.CanonicalHeaderKey(strings.TrimSpace(pair[0])),
+			insensitive: insensitive,
+		}
+		if len(pair) == 2 {
+			m.value = strings.TrimSpace(pair[1])
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// match reports whether h satisfies the matcher
+func (m headerMatcher) match(h http.Header) bool {
+	vals, ok := h[m.name]
+	if !ok {
+		return false
+	}
+	if m.value == "" {
+		return true
+	}
+
+	for _, v := range vals {
+		v = strings.TrimSpace(v)
+		if v == m.value || (m.insensitive && strings.EqualFold(v, m.value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAllHeaders reports whether h satisfies every matcher
+func matchAllHeaders(ms []headerMatcher, h http.Header) bool {
+	for _, m := range ms {
+		if !m.match(h) {
+			return false
+		}
+	}
+	return true
+}
+
+// seenSet records keys that have been seen before. It is
+// safe for concurrent use.
+type seenSet struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newSeenSet() *seenSet {
+	return &seenSet{seen: make(map[string]bool)}
+}
+
+// first reports whether this is the first time key has been
+// seen, recording it if so
+func (s *seenSet) first(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[key] {
+		return false
+	}
+	s.seen[key] = true
+	return true
+}
+
+// has reports whether key has been seen
+func (s *seenSet) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen[key]
+}
+
+// bodyMatcher is a labelled regular expression matched against bodies
+type bodyMatcher struct {
+	label string
+	re    *regexp.Regexp
+}
+
+// loadBodyMatchers reads patterns from the file at path, one per line.
+// A line may start with a label followed by a tab; otherwise the
+// pattern itself is used as the label. Lines starting with # are
+// ignored.
+func loadBodyMatchers(path string) ([]bodyMatcher, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []bodyMatcher
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		label, pattern := line, line
+		if pair := strings.SplitN(line, "\t", 2); len(pair) == 2 {
+			label, pattern = strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+		out = append(out, bodyMatcher{label: label, re: re})
+	}
+	return out, nil
+}
+
+// matchBody returns the labels of every matcher that matches body
+func matchBody(ms []bodyMatcher, body []byte) []string {
+	var labels []string
+	for _, m := range ms {
+		if m.re.Match(body) {
+			labels = append(labels, m.label)
+		}
+	}
+	return labels
+}
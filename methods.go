@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseMethods splits a comma separated list of HTTP methods,
+// upper-casing them and rejecting anything that isn't a token
+func parseMethods(list string) ([]string, error) {
+	var methods []string
+	for _, m := range strings.Split(list, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			continue
+		}
+		if strings.IndexFunc(m, func(r rune) bool { return r < 'A' || r > 'Z' }) != -1 {
+			return nil, fmt.Errorf("invalid method %q", m)
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+// methodSummary probes url with each of methods and returns an
+// annotation giving the status for each one, or the error category
+// if the probe failed. The Allow header of an OPTIONS response is
+// included when there is one.
+func methodSummary(client *http.Client, url string, opts *probeOptions, methods []string) string {
+	o := *opts
+	o.portMethods = nil
+	o.keepBody = false
+	o.noDrain = true
+
+	var parts []string
+	var allow string
+	for _, m := range methods {
+		o.method = m
+		res, err := isListening(client, url, &o)
+		if err != nil {
+			parts = append(parts, m+":"+strings.Replace(errorCategory(err), " ", "-", -1))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d", m, res.resp.StatusCode))
+		if m == "OPTIONS" {
+			allow = res.resp.Header.Get("Allow")
+		}
+	}
+	if allow != "" {
+		parts = append(parts, "allow="+strings.Replace(allow, " ", "", -1))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
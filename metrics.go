@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counters tracks the progress of a scan. The fields are
+// updated atomically by the workers so they must be read
+// with atomic.LoadInt64.
+type counters struct {
+	total    int64
+	alive    int64
+	dead     int64
+	inflight int64
+	bytes    int64
+
+	// statuses counts responses by status code
+	mu       sync.Mutex
+	statuses map[int]int64
+}
+
+// start records that a probe has been started
+func (c *counters) start() {
+	atomic.AddInt64(&c.inflight, 1)
+}
+
+// finish records the outcome of a probe that has completed
+func (c *counters) finish(alive bool) {
+	atomic.AddInt64(&c.inflight, -1)
+	atomic.AddInt64(&c.total, 1)
+	if alive {
+		atomic.AddInt64(&c.alive, 1)
+	} else {
+		atomic.AddInt64(&c.dead, 1)
+	}
+}
+
+// addBytes records n bytes of response body having been read
+func (c *counters) addBytes(n int64) {
+	atomic.AddInt64(&c.bytes, n)
+}
+
+// addStatus records a response with the status code code
+func (c *counters) addStatus(code int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.statuses == nil {
+		c.statuses = make(map[int]int64)
+	}
+	c.statuses[code]++
+}
+
+// statusCounts returns the status codes seen in ascending
+// order along with the number of responses for each
+func (c *counters) statusCounts() ([]int, map[int]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	codes := make([]int, 0, len(c.statuses))
+	counts := make(map[int]int64, len(c.statuses))
+	for code, n := range c.statuses {
+		codes = append(codes, code)
+		counts[code] = n
+	}
+	sort.Ints(codes)
+	return codes, counts
+}
+
+// summary writes a human readable summary of the counters to w
+func (c *counters) summary(w io.Writer) {
+	fmt.Fprintf(w, "probed: %d, alive: %d, dead: %d\n",
+		atomic.LoadInt64(&c.total),
+		atomic.LoadInt64(&c.alive),
+		atomic.LoadInt64(&c.dead),
+	)
+	fmt.Fprintf(w, "downloaded: %s\n", humanBytes(atomic.LoadInt64(&c.bytes)))
+
+	codes, counts := c.statusCounts()
+	if len(codes) == 0 {
+		return
+	}
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%d: %d", code, counts[code])
+	}
+	fmt.Fprintf(w, "status codes: %s\n", strings.Join(parts, ", "))
+}
+
+// reportProgress writes a progress line to w every interval until
+// the returned function is called
+func (c *counters) reportProgress(w io.Writer, interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(w, "probed=%d alive=%d inflight=%d\n",
+					atomic.LoadInt64(&c.total),
+					atomic.LoadInt64(&c.alive),
+					atomic.LoadInt64(&c.inflight),
+				)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// humanBytes formats n as a number of bytes, kilobytes etc
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// ServeHTTP writes the counters in the Prometheus text format
+func (c *counters) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics := []struct {
+		name string
+		help string
+		kind string
+		val  *int64
+	}{
+		{"httprobe_probes_total", "Total number of completed probes.", "counter", &c.total},
+		{"httprobe_probes_alive_total", "Number of probes that got a response.", "counter", &c.alive},
+		{"httprobe_probes_dead_total", "Number of probes that failed.", "counter", &c.dead},
+		{"httprobe_probes_inflight", "Number of probes currently in progress.", "gauge", &c.inflight},
+		{"httprobe_body_bytes_total", "Number of response body bytes read.", "counter", &c.bytes},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		fmt.Fprintf(w, "%s %d\n", m.name, atomic.LoadInt64(m.val))
+	}
+
+	fmt.Fprintln(w, "# HELP httprobe_responses_total Number of responses by status code.")
+	fmt.Fprintln(w, "# TYPE httprobe_responses_total counter")
+	codes, counts := c.statusCounts()
+	for _, code := range codes {
+		fmt.Fprintf(w, "httprobe_responses_total{code=\"%d\"} %d\n", code, counts[code])
+	}
+}
+
+// serveMetrics starts an HTTP server exposing the counters on
+// /metrics. The returned server should be closed once the scan
+// has finished.
+func serveMetrics(addr string, c *counters) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			fmt.Fprintf(os.Stderr, "failed to start metrics server: %s\n", err)
+		}
+	}()
+
+	return srv
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcLogin is a login and password from a .netrc file
+type netrcLogin struct {
+	login    string
+	password string
+}
+
+// netrc holds the credentials from a .netrc file keyed by machine name
+type netrc struct {
+	machines map[string]netrcLogin
+}
+
+// netrcPath returns the location of the user's .netrc file
+func netrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".netrc"
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// loadNetrc reads and parses the .netrc file at path
+func loadNetrc(path string) (*netrc, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(b)), nil
+}
+
+// parseNetrc parses the contents of a .netrc file. Macro definitions,
+// account tokens and the default entry are ignored; sending default
+// credentials to every scanned host would leak them.
+func parseNetrc(data string) *netrc {
+	n := &netrc{machines: make(map[string]netrcLogin)}
+
+	var machine string
+	var current *netrcLogin
+	save := func() {
+		if current == nil || machine == "" {
+			return
+		}
+		n.machines[machine] = *current
+	}
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+
+			switch fields[j] {
+			case "machine":
+				save()
+				machine = next()
+				current = &netrcLogin{}
+			case "default":
+				save()
+				machine = ""
+				current = &netrcLogin{}
+			case "login":
+				if current != nil {
+					current.login = next()
+				}
+			case "password":
+				if current != nil {
+					current.password = next()
+				}
+			case "account":
+				next()
+			case "macdef":
+				// a macro runs until the next blank line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	save()
+
+	return n
+}
+
+// lookup returns the credentials of the machine entry for host
+func (n *netrc) lookup(host string) (netrcLogin, bool) {
+	l, ok := n.machines[host]
+	return l, ok
+}
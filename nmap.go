@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// grepableURLs parses a line of Nmap or masscan greppable output
+// (-oG) and returns URLs for each open TCP port on the host. The
+// scheme is inferred from the service name and port; when it can't
+// be inferred both http and https are returned.
+func grepableURLs(line string) []string {
+	var host string
+	var ports []string
+
+	for _, field := range strings.Split(line, "\t") {
+		switch {
+		case strings.HasPrefix(field, "Host: "):
+			// Host: 10.0.0.1 (name.example.com)
+			parts := strings.Fields(strings.TrimPrefix(field, "Host: "))
+			if len(parts) == 0 {
+				continue
+			}
+			host = parts[0]
+			if len(parts) > 1 {
+				name := strings.Trim(parts[1], "()")
+				if name != "" {
+					host = name
+				}
+			}
+
+		case strings.HasPrefix(field, "Ports: "):
+			ports = strings.Split(strings.TrimPrefix(field, "Ports: "), ",")
+		}
+	}
+
+	if host == "" {
+		return nil
+	}
+
+	var urls []string
+	for _, p := range ports {
+		// port/state/protocol/owner/service/rpc info/version/
+		parts := strings.Split(strings.TrimSpace(p), "/")
+		if len(parts) < 3 || parts[1] != "open" || parts[2] != "tcp" {
+			continue
+		}
+
+		port := parts[0]
+		service := ""
+		if len(parts) > 4 {
+			service = strings.ToLower(parts[4])
+		}
+
+		for _, scheme := range inferSchemes(port, service) {
+			urls = append(urls, scheme+"://"+net.JoinHostPort(host, port))
+		}
+	}
+
+	return urls
+}
+
+// inferSchemes guesses which schemes a port should be probed with
+func inferSchemes(port, service string) []string {
+	switch {
+	case port == "443", strings.Contains(service, "https"), strings.Contains(service, "ssl"):
+		return []string{"https"}
+	case port == "80", strings.Contains(service, "http"):
+		return []string{"http"}
+	}
+	return []string{"http", "https"}
+}
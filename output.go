@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lineWriter writes lines of output through a buffer. When flush is
+// set the buffer is flushed after every line so that output appears
+// immediately. It is safe for concurrent use.
+type lineWriter struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	flush bool
+}
+
+func newLineWriter(w io.Writer, flush bool) *lineWriter {
+	return &lineWriter{w: bufio.NewWriter(w), flush: flush}
+}
+
+// println writes line followed by a newline
+func (lw *lineWriter) println(line string) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.w.WriteString(line)
+	lw.w.WriteByte('\n')
+	if lw.flush {
+		lw.w.Flush()
+	}
+}
+
+// Flush writes any buffered output
+func (lw *lineWriter) Flush() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Flush()
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// jsonResult is the JSON representation of a live URL
+type jsonResult struct {
+	URL        string `json:"url"`
+	Input      string `json:"input,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+
+	// Gone is set with -diff for URLs that were live in the
+	// previous run but aren't any more
+	Gone bool `json:"gone,omitempty"`
+
+	// Redirects are the hops followed with -r, in order
+	Redirects []redirectHop `json:"redirects,omitempty"`
+}
+
+// redirectHop is a redirect response that was followed
+type redirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+}
+
+// redirectChain returns the redirects that were followed to get resp.
+// Each request made for a redirect keeps the response that caused it,
+// so the chain can be walked backwards from the final response.
+func redirectChain(resp *http.Response) []redirectHop {
+	var hops []redirectHop
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		hops = append([]redirectHop{{URL: r.Request.URL.String(), StatusCode: r.StatusCode}}, hops...)
+	}
+	return hops
+}
+
+// stripDefaultPort removes the port from rawurl when it's the default
+// for the scheme, e.g. https://example.com:443/ becomes
+// https://example.com/. The rest of the URL is left exactly as it is.
+func stripDefaultPort(rawurl string) string {
+	i := strings.Index(rawurl, "://")
+	if i == -1 {
+		return rawurl
+	}
+	scheme, rest := rawurl[:i], rawurl[i+3:]
+	host, tail := splitHost(rest)
+
+	var port string
+	switch strings.ToLower(scheme) {
+	case "http":
+		port = ":80"
+	case "https":
+		port = ":443"
+	default:
+		return rawurl
+	}
+	if !strings.HasSuffix(host, port) {
+		return rawurl
+	}
+	return scheme + "://" + strings.TrimSuffix(host, port) + tail
+}
+
+// canonicalURL rewrites rawurl into a canonical form for output: the
+// scheme and host are lowercased, trailing dots are removed from the
+// host, default ports are dropped and query parameters are sorted.
+// URLs that can't be parsed are returned unchanged.
+func canonicalURL(rawurl string) string {
+	u, err := neturl.Parse(stripDefaultPort(rawurl))
+	if err != nil || u.Host == "" {
+		return rawurl
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimRight(strings.ToLower(host), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.RawQuery != "" {
+		if q, err := neturl.ParseQuery(u.RawQuery); err == nil {
+			// Encode sorts by key
+			u.RawQuery = q.Encode()
+		}
+	}
+
+	// stripDefaultPort only matches a lowercase scheme, so try again
+	// now that it's been lowercased
+	return stripDefaultPort(u.String())
+}
+
+// newJSONResult builds the JSON representation of res
+func newJSONResult(res *probeResult) jsonResult {
+	return jsonResult{
+		URL:        res.url,
+		StatusCode: res.resp.StatusCode,
+		Protocol:   res.resp.Proto,
+		Redirects:  redirectChain(res.resp),
+	}
+}
+
+// rotatingFile is an append-only file that is renamed with a
+// timestamp suffix and reopened once it grows beyond maxSize
+// bytes. A maxSize of zero disables rotation. It is safe for
+// concurrent use.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	size    int64
+	f       *os.File
+}
+
+// openRotatingFile opens path for appending
+func openRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.f = f
+	rf.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file out of the way and opens a new one
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+
+	rotated := rf.path + "." + time.Now().Format("20060102-150405.000000")
+	if err := os.Rename(rf.path, rotated); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// writeJSON appends v to the file as a single line of JSON
+func (rf *rotatingFile) writeJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = rf.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the underlying file
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+// parkedKeywords are phrases found on the placeholder pages served
+// for parked and for-sale domains
+var parkedKeywords = []string{
+	"this domain is for sale",
+	"this domain may be for sale",
+	"buy this domain",
+	"domain is parked",
+	"parked free",
+	"parked domain",
+	"domain parking",
+	"this web page is parked",
+	"sedoparking",
+	"parkingcrew",
+	"bodis.com",
+	"domain has expired",
+	"hugedomains",
+}
+
+// parkedNets are networks run by common domain parking services
+var parkedNets = parseCIDRs(
+	"34.102.136.180/32", // GoDaddy
+	"91.195.240.0/23",   // Sedo
+	"185.53.176.0/22",   // ParkingCrew
+	"199.59.240.0/22",   // Bodis
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var out []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// isParked reports whether res looks like a parked domain, either
+// because it was served from a known parking network or because its
+// title or body contains a parking keyword. The second return value
+// says why.
+func isParked(res *probeResult) (bool, string) {
+	if host, _, err := net.SplitHostPort(res.remoteAddr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			for _, n := range parkedNets {
+				if n.Contains(ip) {
+					return true, "parking IP " + host
+				}
+			}
+		}
+	}
+
+	title := strings.ToLower(extractTitle(res.body, res.resp.Header.Get("Content-Type")))
+	body := bytes.ToLower(res.body)
+	for _, k := range parkedKeywords {
+		if strings.Contains(title, k) || bytes.Contains(body, []byte(k)) {
+			return true, "keyword " + k
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// probeOptions controls how each probe request is made
+type probeOptions struct {
+	method        string
+	portMethods   map[string]string
+	data          []byte
+	headers       http.Header
+	randomHeaders *headerPool
+	netrc         *netrc
+	keepBody      bool
+
+	// noDrain closes the response body without reading it
+	noDrain bool
+
+	// websocket sends a WebSocket upgrade handshake
+	websocket bool
+
+	// referer is sent as the Referer header; if it's empty and
+	// autoReferer is set the root of the probed URL is sent instead
+	referer     string
+	autoReferer bool
+
+	// expectContinue sends Expect: 100-continue with the request body
+	expectContinue bool
+
+	// timeoutRetries and connRetries are the number of times
+	// to retry after a timeout and a connection error
+	timeoutRetries int
+	connRetries    int
+	backoff        backoff
+}
+
+// backoff decides how long to wait before each retry
+type backoff struct {
+	// strategy is one of constant, linear or exponential
+	strategy string
+
+	// base is the delay before the first retry, and max caps
+	// the total delay across all of the retries for a probe
+	base time.Duration
+	max  time.Duration
+}
+
+// delay returns how long to wait before the nth retry, starting at 1
+func (b backoff) delay(n int) time.Duration {
+	switch b.strategy {
+	case "linear":
+		return b.base * time.Duration(n)
+	case "exponential":
+		return b.base * time.Duration(1<<uint(n-1))
+	}
+	return b.base
+}
+
+// validBackoff reports whether strategy is a known backoff strategy
+func validBackoff(strategy string) bool {
+	switch strategy {
+	case "constant", "linear", "exponential":
+		return true
+	}
+	return false
+}
+
+// probeResult holds the response to a successful probe. The response
+// body has already been closed; the (possibly capped) body is in body
+// when probeOptions.keepBody is set.
+type probeResult struct {
+	url  string
+	resp *http.Response
+	body []byte
+
+	// length is the number of bytes in the response body
+	length int64
+
+	// elapsed is the time taken for the whole request, and ttfb
+	// the time until the first byte of the response was received
+	elapsed time.Duration
+	ttfb    time.Duration
+
+	// remoteAddr is the address the connection was made to
+	remoteAddr string
+
+	// continued is set when the server sent a 100 Continue
+	// response before the final one
+	continued bool
+}
+
+// isListening makes a request to url and returns the result, retrying
+// timeouts and connection errors as configured. A non-nil error means
+// the URL isn't listening.
+func isListening(client *http.Client, url string, opts *probeOptions) (*probeResult, error) {
+	timeoutRetries, connRetries := opts.timeoutRetries, opts.connRetries
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		res, err := probeOnce(client, url, opts)
+		if err == nil {
+			return res, nil
+		}
+
+		retry := false
+		switch errorCategory(err) {
+		case "timeout":
+			if timeoutRetries > 0 {
+				timeoutRetries--
+				retry = true
+			}
+		case "connection refused", "connection reset":
+			if connRetries > 0 {
+				connRetries--
+				retry = true
+			}
+		}
+		if !retry {
+			return nil, err
+		}
+
+		d := opts.backoff.delay(attempt)
+		if opts.backoff.max > 0 && waited+d > opts.backoff.max {
+			d = opts.backoff.max - waited
+		}
+		time.Sleep(d)
+		waited += d
+	}
+}
+
+// probeOnce makes a single request to url
+func probeOnce(client *http.Client, url string, opts *probeOptions) (*probeResult, error) {
+	var reqBody io.Reader
+	if opts.data != nil {
+		reqBody = bytes.NewReader(opts.data)
+	}
+
+	// internationalised hosts are requested using punycode
+	// but reported in their original form
+	req, err := http.NewRequest(opts.method, asciiURL(url), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := opts.portMethods[urlPort(req.URL)]; ok {
+		req.Method = m
+	}
+
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_4) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/73.0.3683.103 Safari/537.36")
+	req.Header.Add("Accept", "*/*")
+	req.Header.Add("Accept-Language", "en-US,en;q=0.8")
+	req.Header.Add("Connection", "close")
+	if opts.data != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if opts.expectContinue {
+			req.Header.Set("Expect", "100-continue")
+		}
+	}
+	switch {
+	case opts.referer != "":
+		req.Header.Set("Referer", opts.referer)
+	case opts.autoReferer:
+		req.Header.Set("Referer", req.URL.Scheme+"://"+req.URL.Host+"/")
+	}
+	if opts.randomHeaders != nil {
+		opts.randomHeaders.apply(req.Header)
+	}
+	for name, vals := range opts.headers {
+		if name == "Host" {
+			req.Host = vals[0]
+			continue
+		}
+		req.Header[name] = vals
+	}
+	if opts.netrc != nil && req.Header.Get("Authorization") == "" {
+		if l, ok := opts.netrc.lookup(req.URL.Hostname()); ok {
+			req.SetBasicAuth(l.login, l.password)
+		}
+	}
+	req.Close = true
+
+	// an upgrade request can't also ask for the connection to be
+	// closed, but it's closed after the 101 response regardless
+	if opts.websocket {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", websocketKey())
+		req.Close = false
+	}
+
+	start := time.Now()
+	var ttfb time.Duration
+	var connected int32
+	var remoteAddr string
+	var continued int32
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			atomic.StoreInt32(&connected, 1)
+			remoteAddr = info.Conn.RemoteAddr().String()
+		},
+		GotFirstResponseByte: func() {
+			ttfb = time.Since(start)
+		},
+		Got100Continue: func() {
+			atomic.StoreInt32(&continued, 1)
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	var body []byte
+	var length int64
+	resp, err := client.Do(req)
+	if resp != nil {
+		switch {
+		case resp.StatusCode == http.StatusSwitchingProtocols:
+			// the body is the upgraded connection, which
+			// would block until the server closes it
+		case opts.keepBody:
+			body, length = readBody(resp.Body)
+		case !opts.noDrain:
+			length, _ = io.Copy(ioutil.Discard, resp.Body)
+		}
+		resp.Body.Close()
+	}
+	elapsed := time.Since(start)
+	if err != nil {
+		if atomic.LoadInt32(&connected) == 1 && errorCategory(err) == "timeout" {
+			return nil, hangError{err}
+		}
+		return nil, err
+	}
+
+	return &probeResult{
+		url:     url,
+		resp:    resp,
+		body:    body,
+		length:  length,
+		elapsed: elapsed,
+		ttfb:    ttfb,
+
+		remoteAddr: remoteAddr,
+		continued:  atomic.LoadInt32(&continued) == 1,
+	}, nil
+}
+
+// websocketKey returns a random Sec-WebSocket-Key value
+func websocketKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// addrFamily returns IPv4 or IPv6 for a host:port address
+func addrFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// hangError is returned when a connection was made but the
+// server didn't respond before the timeout
+type hangError struct {
+	err error
+}
+
+func (e hangError) Error() string {
+	return "connected but timed out waiting for a response: " + e.err.Error()
+}
+
+func (e hangError) Unwrap() error {
+	return e.err
+}
+
+// errorCategory classifies a probe error into a short
+// description of why the probe failed
+func errorCategory(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection reset"
+	}
+
+	var recErr tls.RecordHeaderError
+	var certErr x509.UnknownAuthorityError
+	if errors.As(err, &recErr) || errors.As(err, &certErr) || strings.Contains(err.Error(), "tls:") {
+		return "tls"
+	}
+
+	return "other"
+}
+
+// maxBodySize caps how much of a response body is kept in memory
+const maxBodySize = 1024 * 1024
+
+// readBody reads up to maxBodySize bytes from r and discards
+// the rest so that the connection is drained. The total length
+// of the body is returned along with the capped body.
+func readBody(r io.Reader) ([]byte, int64) {
+	body, _ := ioutil.ReadAll(io.LimitReader(r, maxBodySize))
+	rest, _ := io.Copy(ioutil.Discard, r)
+	return body, int64(len(body)) + rest
+}
+
+// bodyContains reports whether body contains the substring s. When
+// insensitive is set s is expected to already be lowercase.
+func bodyContains(body []byte, s string, insensitive bool) bool {
+	if insensitive {
+		body = bytes.ToLower(body)
+	}
+	return bytes.Contains(body, []byte(s))
+}
+
+// urlPort returns the port of u, falling back to
+// the default port for its scheme
+func urlPort(u *neturl.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	switch u.Scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// redirected reports whether resp is a redirect, or was
+// reached by following one
+func redirected(resp *http.Response) bool {
+	if resp.StatusCode >= 300 && resp.StatusCode <= 399 {
+		return true
+	}
+	return resp.Request != nil && resp.Request.Response != nil
+}
+
+// hostname returns the host of rawurl without any port
+func hostname(rawurl string) string {
+	u, err := neturl.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return u.Hostname()
+}
+
+// parsePortMethods parses a mapping of ports to methods in
+// the form 8080=GET,9000=POST
+func parsePortMethods(raw string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid port method mapping: %s", pair)
+		}
+		if _, err := strconv.Atoi(parts[0]); err != nil {
+			return nil, fmt.Errorf("invalid port in method mapping: %s", parts[0])
+		}
+		out[parts[0]] = strings.ToUpper(parts[1])
+	}
+	return out, nil
+}
+
+// readData returns the request body given to -data. A value
+// starting with @ is treated as the name of a file to read.
+func readData(data string) ([]byte, error) {
+	if strings.HasPrefix(data, "@") {
+		return ioutil.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
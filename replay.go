@@ -0,0 +1,20 @@
+package main
+
+import "strings"
+
+// replayURL returns the URL on a line of a -replay file. Lines can be
+// full URLs or the "failed: <url> (<reason>)" lines written by -v, so
+// that the stderr of one run can be fed straight into the next. Lines
+// without a scheme aren't URLs and are rejected.
+func replayURL(line string) (string, bool) {
+	if strings.HasPrefix(line, "failed: ") {
+		line = strings.TrimPrefix(line, "failed: ")
+		if i := strings.Index(line, " ("); i != -1 {
+			line = line[:i]
+		}
+	}
+	if !strings.Contains(line, "://") || strings.ContainsAny(line, " \t") {
+		return "", false
+	}
+	return line, true
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// robotsRule is a single Allow or Disallow line from robots.txt
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsCache fetches and caches the robots.txt rules for each
+// scheme and host so that each file is only requested once
+type robotsCache struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	once  sync.Once
+	rules []robotsRule
+}
+
+func newRobotsCache(client *http.Client) *robotsCache {
+	return &robotsCache{
+		client:  client,
+		entries: make(map[string]*robotsEntry),
+	}
+}
+
+// allowed reports whether the robots.txt for the host in rawurl
+// allows the URL to be fetched by any user agent. URLs without
+// a path are always allowed.
+func (rc *robotsCache) allowed(rawurl string) bool {
+	u, err := url.Parse(asciiURL(rawurl))
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return true
+	}
+
+	base := u.Scheme + "://" + u.Host
+
+	rc.mu.Lock()
+	e, ok := rc.entries[base]
+	if !ok {
+		e = &robotsEntry{}
+		rc.entries[base] = e
+	}
+	rc.mu.Unlock()
+
+	e.once.Do(func() {
+		e.rules = rc.fetch(base)
+	})
+
+	return robotsAllowed(e.rules, u.EscapedPath())
+}
+
+// fetch requests robots.txt from base and parses the rules that
+// apply to all user agents. Any failure is treated as no rules.
+func (rc *robotsCache) fetch(base string) []robotsRule {
+	resp, err := rc.client.Get(base + "/robots.txt")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxBodySize))
+}
+
+// parseRobots returns the rules in the groups of a robots.txt
+// file that apply to the * user agent
+func parseRobots(r io.Reader) []robotsRule {
+	var rules []robotsRule
+
+	// a group is one or more User-agent lines followed by rules
+	applies := false
+	inAgents := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		pair := strings.SplitN(line, ":", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(pair[0]))
+		val := strings.TrimSpace(pair[1])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				applies = false
+			}
+			inAgents = true
+			if val == "*" {
+				applies = true
+			}
+
+		case "allow", "disallow":
+			inAgents = false
+			if !applies || val == "" {
+				continue
+			}
+			rules = append(rules, robotsRule{
+				allow:   key == "allow",
+				pattern: val,
+				re:      robotsPattern(val),
+			})
+		}
+	}
+
+	return rules
+}
+
+// robotsPattern converts a robots.txt path pattern, which may
+// contain * wildcards and a trailing $ anchor, to a regexp
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+
+	expr := "^" + strings.Replace(regexp.QuoteMeta(p), `\*`, ".*", -1)
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsAllowed applies the most specific matching rule to path.
+// Allow wins when an Allow and Disallow rule are equally specific.
+func robotsAllowed(rules []robotsRule, path string) bool {
+	allowed := true
+	longest := -1
+
+	for _, r := range rules {
+		if !r.re.MatchString(path) {
+			continue
+		}
+		if len(r.pattern) > longest || (len(r.pattern) == longest && r.allow) {
+			longest = len(r.pattern)
+			allowed = r.allow
+		}
+	}
+
+	return allowed
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// scopeFilter skips hosts that resolve to an address outside of
+// the public or private scope given to -scope. Each host is only
+// resolved once. A nil scopeFilter allows every host. It is safe
+// for concurrent use.
+type scopeFilter struct {
+	private bool
+	timeout time.Duration
+	lookup  func(context.Context, string) ([]string, error)
+
+	mu sync.Mutex
+	// outside is the first out of scope address of each host that's
+	// been checked, or the empty string if they're all in scope
+	outside map[string]string
+}
+
+func newScopeFilter(scope string, timeout time.Duration, lookup func(context.Context, string) ([]string, error)) (*scopeFilter, error) {
+	if scope != "public" && scope != "private" {
+		return nil, fmt.Errorf("unknown scope %q (want public or private)", scope)
+	}
+	return &scopeFilter{
+		private: scope == "private",
+		timeout: timeout,
+		lookup:  lookup,
+		outside: make(map[string]string),
+	}, nil
+}
+
+// check returns the first address of host that's out of scope, or
+// the empty string if every address is in scope. Hosts that can't be
+// resolved are left for the probe to fail on.
+func (s *scopeFilter) check(host string) string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	addr, ok := s.outside[host]
+	s.mu.Unlock()
+	if ok {
+		return addr
+	}
+
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		var err error
+		addrs, err = s.lookup(ctx, host)
+		if err != nil {
+			return ""
+		}
+	}
+
+	addr = ""
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip != nil && isPrivateIP(ip) != s.private {
+			addr = a
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.outside[host] = addr
+	s.mu.Unlock()
+	return addr
+}
+
+// isPrivateIP reports whether ip is in a private, loopback,
+// link-local or unspecified range
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// result is a live URL ready to be output
+type result struct {
+	// url is the URL that was probed, which can differ from the
+	// URL that's output with -canonicalize or -drop-default-ports
+	url string
+
+	// line is the text form of the result, including any annotations
+	line string
+
+	// json is the JSON form of the result
+	json jsonResult
+}
+
+// Sink is a destination for results. Emit may be called
+// from several goroutines at once.
+type Sink interface {
+	Emit(r *result) error
+	Close() error
+}
+
+// textSink writes the text form of each result to a lineWriter,
+// closing c (if set) when the sink is closed
+type textSink struct {
+	out *lineWriter
+	c   io.Closer
+}
+
+// newFileSink creates the file at path and returns a sink that writes
+// results to it in a format chosen by the file extension: JSON lines
+// for .json and .jsonl, CSV for .csv and plain text for anything else
+func newFileSink(path string) (Sink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl":
+		w := bufio.NewWriter(f)
+		return &jsonFileSink{w: w, enc: json.NewEncoder(w), f: f}, nil
+	case ".csv":
+		s := &csvSink{w: csv.NewWriter(f), f: f}
+		s.w.Write(csvHeader)
+		return s, nil
+	}
+	return &textSink{out: newLineWriter(f, false), c: f}, nil
+}
+
+func (s *textSink) Emit(r *result) error {
+	s.out.println(r.line)
+	return nil
+}
+
+func (s *textSink) Close() error {
+	err := s.out.Flush()
+	if s.c != nil {
+		if cerr := s.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// jsonLinesSink appends the JSON form of each result to a file
+type jsonLinesSink struct {
+	f *rotatingFile
+}
+
+func (s *jsonLinesSink) Emit(r *result) error {
+	return s.f.writeJSON(r.json)
+}
+
+func (s *jsonLinesSink) Close() error {
+	return s.f.Close()
+}
+
+// urlSink appends the URL of each result to a file, flushing after
+// every line so that nothing is lost if the scan is interrupted
+type urlSink struct {
+	out *lineWriter
+	f   *os.File
+}
+
+// newURLSink opens the file at path for appending, creating it if needed
+func newURLSink(path string) (*urlSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &urlSink{out: newLineWriter(f, true), f: f}, nil
+}
+
+func (s *urlSink) Emit(r *result) error {
+	s.out.println(r.json.URL)
+	return nil
+}
+
+func (s *urlSink) Close() error {
+	err := s.out.Flush()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// splitSink writes the text form of each result to a file in dir
+// named after its status class, such as 2xx.txt. Files are created
+// as each class is first seen. Results without a status code, such
+// as those from -tcp-only, aren't written.
+type splitSink struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[int]*textSink
+}
+
+// newSplitSink returns a splitSink for dir, creating it if needed
+func newSplitSink(dir string) (*splitSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &splitSink{dir: dir, files: make(map[int]*textSink)}, nil
+}
+
+func (s *splitSink) Emit(r *result) error {
+	class := r.json.StatusCode / 100
+	if class < 1 || class > 5 {
+		return nil
+	}
+
+	s.mu.Lock()
+	ts, ok := s.files[class]
+	if !ok {
+		f, err := os.Create(filepath.Join(s.dir, fmt.Sprintf("%dxx.txt", class)))
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		ts = &textSink{out: newLineWriter(f, false), c: f}
+		s.files[class] = ts
+	}
+	s.mu.Unlock()
+
+	return ts.Emit(r)
+}
+
+func (s *splitSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, ts := range s.files {
+		if cerr := ts.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// jsonFileSink writes the JSON form of each result to a file, one per line
+type jsonFileSink struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	f   *os.File
+}
+
+func (s *jsonFileSink) Emit(r *result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(r.json)
+}
+
+func (s *jsonFileSink) Close() error {
+	err := s.w.Flush()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// csvHeader names the columns written by csvSink
+var csvHeader = []string{"url", "status_code", "protocol", "input", "timestamp"}
+
+// csvSink writes each result to a file as a CSV row
+type csvSink struct {
+	mu sync.Mutex
+	w  *csv.Writer
+	f  *os.File
+}
+
+func (s *csvSink) Emit(r *result) error {
+	// there's no column to mark -diff's gone URLs with
+	if r.json.Gone {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ""
+	if r.json.StatusCode != 0 {
+		status = strconv.Itoa(r.json.StatusCode)
+	}
+	return s.w.Write([]string{r.json.URL, status, r.json.Protocol, r.json.Input, r.json.Timestamp})
+}
+
+func (s *csvSink) Close() error {
+	s.w.Flush()
+	err := s.w.Error()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// webhookQueueSize is how many results can be waiting to be POSTed
+// before more are dropped
+const webhookQueueSize = 1000
+
+// webhookSink POSTs the JSON form of each result to a URL. Results
+// are queued and delivered in the background so that a slow webhook
+// doesn't hold up probing. Failed deliveries are reported on stderr
+// when the sink is closed but aren't treated as output errors.
+type webhookSink struct {
+	url     string
+	client  *http.Client
+	timeout time.Duration
+
+	queue  chan []byte
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// dropped counts results that didn't fit in the queue
+	mu      sync.Mutex
+	dropped int
+
+	// failed and lastErr belong to deliver until done is closed
+	failed  int
+	lastErr error
+}
+
+func newWebhookSink(url string, timeout time.Duration) *webhookSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &webhookSink{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		timeout: timeout,
+		queue:   make(chan []byte, webhookQueueSize),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go s.deliver()
+	return s
+}
+
+func (s *webhookSink) Emit(r *result) error {
+	b, err := json.Marshal(r.json)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case s.queue <- b:
+	default:
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// deliver POSTs queued results until the queue is closed
+func (s *webhookSink) deliver() {
+	defer close(s.done)
+	for b := range s.queue {
+		if err := s.post(b); err != nil {
+			s.failed++
+			s.lastErr = err
+		}
+	}
+}
+
+func (s *webhookSink) post(b []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, "POST", s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close waits for the queued results to be delivered, giving up on
+// any still waiting once the timeout has passed
+func (s *webhookSink) Close() error {
+	close(s.queue)
+	t := time.AfterFunc(s.timeout, s.cancel)
+	<-s.done
+	t.Stop()
+	s.cancel()
+
+	if s.failed > 0 {
+		fmt.Fprintf(os.Stderr, "webhook: failed to deliver %d results: %s\n", s.failed, s.lastErr)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "webhook: dropped %d results because the queue was full\n", s.dropped)
+	}
+	return nil
+}
+
+// multiSink sends each result to every sink in the list
+type multiSink []Sink
+
+func (ms multiSink) Emit(r *result) error {
+	var first error
+	for _, s := range ms {
+		if err := s.Emit(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (ms multiSink) Close() error {
+	var first error
+	for _, s := range ms {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// sortedSink buffers every result in memory and sends them to next
+// in order of status code then URL when it's closed. Gone URLs from
+// -diff come after everything else.
+type sortedSink struct {
+	mu      sync.Mutex
+	results []*result
+	next    Sink
+}
+
+func (s *sortedSink) Emit(r *result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, r)
+	return nil
+}
+
+func (s *sortedSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sort.SliceStable(s.results, func(i, j int) bool {
+		a, b := s.results[i].json, s.results[j].json
+		if a.Gone != b.Gone {
+			return b.Gone
+		}
+		if a.StatusCode != b.StatusCode {
+			return a.StatusCode < b.StatusCode
+		}
+		return a.URL < b.URL
+	})
+
+	var first error
+	for _, r := range s.results {
+		if err := s.next.Emit(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	if err := s.next.Close(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
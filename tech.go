@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// techSignature identifies a technology by a response header, a
+// cookie or a pattern in the body. Any one of them matching is
+// enough for the technology to be detected.
+type techSignature struct {
+	name string
+
+	// header must be present, and match value if it's set
+	header string
+	value  *regexp.Regexp
+
+	// cookie is the name of a cookie that's set
+	cookie string
+
+	body *regexp.Regexp
+}
+
+// metaGenerator matches a <meta name="generator"> tag naming a product
+func metaGenerator(product string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)<meta[^>]+name=["']?generator["']?[^>]+content=["']?` + product)
+}
+
+// techSignatures is the built-in set of signatures used by -tech.
+// Technologies are reported in this order.
+var techSignatures = []techSignature{
+	{name: "WordPress", body: metaGenerator("WordPress")},
+	{name: "WordPress", body: regexp.MustCompile(`/wp-(content|includes)/`)},
+	{name: "Drupal", header: "X-Generator", value: regexp.MustCompile(`(?i)drupal`)},
+	{name: "Drupal", header: "X-Drupal-Cache"},
+	{name: "Drupal", body: metaGenerator("Drupal")},
+	{name: "Joomla", body: metaGenerator("Joomla")},
+	{name: "Shopify", header: "X-ShopId"},
+	{name: "Shopify", body: regexp.MustCompile(`cdn\.shopify\.com/`)},
+	{name: "Next.js", header: "X-Powered-By", value: regexp.MustCompile(`(?i)next\.js`)},
+	{name: "Next.js", body: regexp.MustCompile(`__NEXT_DATA__`)},
+	{name: "Laravel", cookie: "laravel_session"},
+	{name: "Express", header: "X-Powered-By", value: regexp.MustCompile(`(?i)express`)},
+	{name: "PHP", header: "X-Powered-By", value: regexp.MustCompile(`(?i)php`)},
+	{name: "PHP", cookie: "PHPSESSID"},
+	{name: "ASP.NET", header: "X-Powered-By", value: regexp.MustCompile(`(?i)asp\.net`)},
+	{name: "ASP.NET", header: "X-AspNet-Version"},
+	{name: "ASP.NET", cookie: "ASP.NET_SessionId"},
+	{name: "Java", cookie: "JSESSIONID"},
+	{name: "nginx", header: "Server", value: regexp.MustCompile(`(?i)nginx`)},
+	{name: "Apache", header: "Server", value: regexp.MustCompile(`(?i)apache`)},
+	{name: "IIS", header: "Server", value: regexp.MustCompile(`(?i)microsoft-iis`)},
+	{name: "LiteSpeed", header: "Server", value: regexp.MustCompile(`(?i)litespeed`)},
+	{name: "Amazon S3", header: "Server", value: regexp.MustCompile(`AmazonS3`)},
+	{name: "Cloudflare", header: "CF-RAY"},
+	{name: "Varnish", header: "X-Varnish"},
+	{name: "jQuery", body: regexp.MustCompile(`(?i)jquery[.-]?[0-9.]*(\.min)?\.js`)},
+	{name: "React", body: regexp.MustCompile(`data-reactroot|react(-dom)?(\.production)?(\.min)?\.js`)},
+	{name: "Angular", body: regexp.MustCompile(`ng-version=`)},
+	{name: "Vue.js", body: regexp.MustCompile(`data-v-[0-9a-f]{8}|vue(\.runtime)?(\.min)?\.js`)},
+	{name: "Bootstrap", body: regexp.MustCompile(`bootstrap(\.bundle)?(\.min)?\.(css|js)`)},
+	{name: "Google Analytics", body: regexp.MustCompile(`google-analytics\.com/|googletagmanager\.com/gtag/`)},
+}
+
+// match reports whether the signature matches the response
+func (s techSignature) match(resp *http.Response, body []byte) bool {
+	switch {
+	case s.header != "":
+		vals, ok := resp.Header[http.CanonicalHeaderKey(s.header)]
+		if !ok {
+			return false
+		}
+		if s.value == nil {
+			return true
+		}
+		for _, v := range vals {
+			if s.value.MatchString(v) {
+				return true
+			}
+		}
+	case s.cookie != "":
+		for _, c := range resp.Cookies() {
+			if c.Name == s.cookie {
+				return true
+			}
+		}
+	case s.body != nil:
+		return s.body.Match(body)
+	}
+	return false
+}
+
+// detectTech returns the technologies matched by techSignatures,
+// formatted as a note like [WordPress, nginx], or the empty string
+// when nothing is detected
+func detectTech(resp *http.Response, body []byte) string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, s := range techSignatures {
+		if seen[s.name] || !s.match(resp, body) {
+			continue
+		}
+		seen[s.name] = true
+		names = append(names, s.name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hostThrottle slows down probing of hosts that respond with 429 Too
+// Many Requests, or 503 with a Retry-After header. Each one adds a
+// per-host delay before further probes, which halves every halfLife
+// so that the host speeds back up once it stops complaining. A nil
+// hostThrottle never delays. It is safe for concurrent use.
+type hostThrottle struct {
+	mu       sync.Mutex
+	base     time.Duration
+	max      time.Duration
+	halfLife time.Duration
+	hosts    map[string]*penalty
+}
+
+type penalty struct {
+	delay time.Duration
+	at    time.Time
+}
+
+func newHostThrottle() *hostThrottle {
+	return &hostThrottle{
+		base:     time.Second,
+		max:      time.Minute,
+		halfLife: 30 * time.Second,
+		hosts:    make(map[string]*penalty),
+	}
+}
+
+// current returns the decayed delay for p
+func (t *hostThrottle) current(p *penalty) time.Duration {
+	halvings := time.Since(p.at) / t.halfLife
+	if halvings > 30 {
+		return 0
+	}
+	return p.delay >> uint(halvings)
+}
+
+// wait sleeps for the current delay for host
+func (t *hostThrottle) wait(host string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	var d time.Duration
+	if p, ok := t.hosts[host]; ok {
+		d = t.current(p)
+		if d == 0 {
+			delete(t.hosts, host)
+		}
+	}
+	t.mu.Unlock()
+	time.Sleep(d)
+}
+
+// observe checks resp for signs that host is rate limiting and, if
+// there are any, doubles its delay or sets it to the Retry-After time
+func (t *hostThrottle) observe(host string, resp *http.Response) {
+	if t == nil {
+		return
+	}
+	retry := retryAfter(resp)
+	if resp.StatusCode != http.StatusTooManyRequests && !(resp.StatusCode == http.StatusServiceUnavailable && retry > 0) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d := t.base
+	if p, ok := t.hosts[host]; ok {
+		d = t.current(p) * 2
+	}
+	if retry > d {
+		d = retry
+	}
+	if d < t.base {
+		d = t.base
+	}
+	if d > t.max {
+		d = t.max
+	}
+	t.hosts[host] = &penalty{delay: d, at: time.Now()}
+}
+
+// retryAfter returns the delay from a Retry-After header given in
+// seconds or as an HTTP date, or zero if there isn't one
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(v); err == nil {
+		return time.Until(when)
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"html"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+var metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([a-z0-9_.:-]+)`)
+
+// extractTitle returns the contents of the <title> element in body
+// with entities decoded and whitespace collapsed, or an empty string
+// if there isn't one. Titles are decoded to UTF-8 using the charset
+// from contentType or a <meta> tag.
+func extractTitle(body []byte, contentType string) string {
+	m := titleRe.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	title := decodeCharset(m[1], bodyCharset(body, contentType))
+	return strings.Join(strings.Fields(html.UnescapeString(title)), " ")
+}
+
+// bodyCharset returns the lowercased charset named by the Content-Type
+// header, falling back to a <meta> tag in the body
+func bodyCharset(body []byte, contentType string) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return strings.ToLower(params["charset"])
+	}
+	if m := metaCharsetRe.FindSubmatch(body); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	return ""
+}
+
+// decodeCharset converts b from the named charset to a UTF-8 string.
+// Charsets are looked up by their WHATWG labels, so multi-byte
+// encodings like Shift_JIS, EUC-KR and GBK are supported as well as
+// Latin-1. Text that's already valid UTF-8, or in an unknown charset,
+// is returned unchanged.
+func decodeCharset(b []byte, label string) string {
+	// pages are often labelled with a charset they don't actually use
+	if label == "" || utf8.Valid(b) {
+		return string(b)
+	}
+
+	enc, _ := charset.Lookup(label)
+	if enc == nil {
+		return string(b)
+	}
+	out, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(out)
+}
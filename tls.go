@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// certExpiryNote returns an annotation for a connection whose leaf
+// certificate has expired or expires within window. An empty string
+// is returned for non-TLS connections and certificates that are fine.
+func certExpiryNote(state *tls.ConnectionState, window time.Duration) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	left := time.Until(state.PeerCertificates[0].NotAfter)
+	days := int(left.Hours() / 24)
+
+	switch {
+	case left < 0:
+		return fmt.Sprintf("[cert expired %dd ago]", -days)
+	case left < window:
+		return fmt.Sprintf("[cert expires in %dd]", days)
+	}
+	return ""
+}
+
+// enableWeakTLS allows the client to negotiate deprecated TLS versions
+// and insecure cipher suites so that servers using them can be found
+func enableWeakTLS(cfg *tls.Config) {
+	cfg.MinVersion = tls.VersionTLS10
+	for _, cs := range tls.CipherSuites() {
+		cfg.CipherSuites = append(cfg.CipherSuites, cs.ID)
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		cfg.CipherSuites = append(cfg.CipherSuites, cs.ID)
+	}
+}
+
+// weakTLSNote returns an annotation for a connection that negotiated
+// a TLS version older than 1.2 or an insecure cipher suite. An empty
+// string is returned for non-TLS connections and strong TLS.
+func weakTLSNote(state *tls.ConnectionState) string {
+	if state == nil {
+		return ""
+	}
+
+	var weak []string
+	if state.Version < tls.VersionTLS12 {
+		weak = append(weak, strings.Replace(tls.VersionName(state.Version), " ", "", -1))
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		if cs.ID == state.CipherSuite {
+			weak = append(weak, cs.Name)
+		}
+	}
+
+	if len(weak) == 0 {
+		return ""
+	}
+	return "[WEAK-TLS: " + strings.Join(weak, ", ") + "]"
+}
+
+// tlsHandshake connects to the host and port in rawurl and performs a
+// TLS handshake without sending a request. Plain http URLs are skipped
+// by the caller; a URL without a port is assumed to use 443.
+func tlsHandshake(dial dialFunc, rawurl string, cfg *tls.Config, timeout time.Duration) (*tls.ConnectionState, error) {
+	u, err := neturl.Parse(asciiURL(rawurl))
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+
+	raw, err := dialTimeout(dial, net.JoinHostPort(u.Hostname(), port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	raw.SetDeadline(time.Now().Add(timeout))
+	conn := tls.Client(raw, cfg)
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := conn.ConnectionState()
+	return &state, nil
+}
+
+// tlsInfoNote returns an annotation describing the TLS version and
+// leaf certificate of a connection
+func tlsInfoNote(state *tls.ConnectionState) string {
+	info := []string{strings.Replace(tls.VersionName(state.Version), " ", "", -1)}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		if cert.Subject.CommonName != "" {
+			info = append(info, "CN="+cert.Subject.CommonName)
+		}
+		info = append(info, "expires "+cert.NotAfter.Format("2006-01-02"))
+	}
+	return "[" + strings.Join(info, ", ") + "]"
+}
+
+// parseCiphers converts a comma separated list of cipher suite names,
+// such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, into their IDs. The
+// TLS_ prefix is optional and case is ignored. TLS 1.3 suites are
+// rejected because Go doesn't allow them to be configured.
+func parseCiphers(list string) ([]uint16, error) {
+	known := make(map[string]*tls.CipherSuite)
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[cs.Name] = cs
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !strings.HasPrefix(name, "TLS_") {
+			name = "TLS_" + name
+		}
+
+		cs, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		if len(cs.SupportedVersions) == 1 && cs.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("TLS 1.3 cipher suite %s can't be selected", name)
+		}
+		ids = append(ids, cs.ID)
+	}
+	return ids, nil
+}
+
+// restrictCiphers limits cfg to the cipher suites in ids. TLS 1.3 is
+// disabled since its suites would be negotiated regardless.
+func restrictCiphers(cfg *tls.Config, ids []uint16) {
+	cfg.CipherSuites = ids
+	cfg.MinVersion = tls.VersionTLS10
+	cfg.MaxVersion = tls.VersionTLS12
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// wildcardFilter detects responses from wildcard DNS records. For each
+// parent domain, scheme, port and path it probes a random subdomain that
+// shouldn't exist and remembers the response signature; real probes with
+// the same signature are likely to be served by the wildcard.
+type wildcardFilter struct {
+	client *http.Client
+	opts   *probeOptions
+
+	mu      sync.Mutex
+	entries map[string]*wildcardEntry
+}
+
+type wildcardEntry struct {
+	once sync.Once
+	sig  string
+}
+
+func newWildcardFilter(client *http.Client, opts *probeOptions) *wildcardFilter {
+	return &wildcardFilter{
+		client:  client,
+		opts:    opts,
+		entries: make(map[string]*wildcardEntry),
+	}
+}
+
+// matches reports whether res looks like it was served by a
+// wildcard DNS record for the parent domain of its host
+func (wf *wildcardFilter) matches(res *probeResult) bool {
+	u, err := neturl.Parse(res.url)
+	if err != nil {
+		return false
+	}
+
+	// apex domains can't match a wildcard record
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) < 3 {
+		return false
+	}
+	parent := strings.Join(labels[1:], ".")
+
+	withHost := func(host string) string {
+		c := *u
+		c.Host = host
+		if port := u.Port(); port != "" {
+			c.Host += ":" + port
+		}
+		return c.String()
+	}
+
+	key := withHost("*." + parent)
+
+	wf.mu.Lock()
+	e, ok := wf.entries[key]
+	if !ok {
+		e = &wildcardEntry{}
+		wf.entries[key] = e
+	}
+	wf.mu.Unlock()
+
+	e.once.Do(func() {
+		random := fmt.Sprintf("wildcard-%08x.%s", rand.Uint32(), parent)
+		wres, err := isListening(wf.client, withHost(random), wf.opts)
+		if err == nil {
+			e.sig = responseSignature(wres)
+		}
+	})
+
+	return e.sig != "" && e.sig == responseSignature(res)
+}
+
+// responseSignature summarises a response by its status
+// code, body length and title
+func responseSignature(res *probeResult) string {
+	return fmt.Sprintf("%d|%d|%s", res.resp.StatusCode, res.length, extractTitle(res.body, res.resp.Header.Get("Content-Type")))
+}